@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/vm"
+)
+
+// RunFileVM runs the script at path on the bytecode virtual machine
+func RunFileVM(path string, cfg config) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+
+	s := newSession(cfg)
+	diagnostics := &errors.Collector{}
+
+	function, hadErrors := compile(path, source, diagnostics)
+	if hadErrors {
+		s.render(diagnostics.Diagnostics, source)
+		os.Exit(65)
+	}
+
+	machine := vm.New(diagnostics)
+	machine.SetOutput(s.stdout)
+	if hadErrors := machine.Interpret(function); hadErrors {
+		s.render(diagnostics.Diagnostics, source)
+		os.Exit(70)
+	}
+	return nil
+}
+
+// DumpBytecode prints the disassembled bytecode compiled from the script
+// at path
+func DumpBytecode(path string, cfg config) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	source := string(bytes)
+
+	s := newSession(cfg)
+	if err := s.dumpBytecode(path, source); err != nil {
+		os.Exit(65)
+	}
+	return nil
+}
+
+func (s *session) dumpBytecode(file string, source string) error {
+	diagnostics := &errors.Collector{}
+	function, hadErrors := compile(file, source, diagnostics)
+	s.render(diagnostics.Diagnostics, source)
+	if hadErrors {
+		return fmt.Errorf("encountered errors while compiling")
+	}
+
+	vm.Disassemble(s.stdout, function)
+	return nil
+}
+
+// compile runs the front end shared with the tree-walking interpreter
+// and compiles the resulting syntax tree to bytecode
+func compile(file string, source string, sink errors.Sink) (*vm.Function, bool) {
+	tokens, hadErrors := lexer.NewFileScanner(file, source, sink).ScanTokens()
+	if hadErrors {
+		return nil, true
+	}
+
+	statements, hadErrors := parser.NewParser(tokens, sink).Parse()
+	if hadErrors {
+		return nil, true
+	}
+
+	if hadErrors := parser.NewResolver(nil, sink).Resolve(statements); hadErrors {
+		return nil, true
+	}
+
+	return vm.NewCompiler(sink).Compile(statements)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/maffkipp/golox"
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+)
+
+const commandHelp = `:tokens <source>   print the tokens scanned from source
+:ast <source>      print the syntax tree parsed from source
+:bytecode <source> print the bytecode compiled from source
+:env               list the global bindings of the session
+:load <file>       run a script in the current session
+:reset             discard all definitions and start a fresh session
+:time <source>     run source and report how long it took
+:help              show this message`
+
+// command runs a REPL meta-command such as ":env" or ":load file.lox"
+func (s *session) command(input string) error {
+	name, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":tokens":
+		diagnostics := &errors.Collector{}
+		tokens, _ := lexer.NewScanner(arg, diagnostics).ScanTokens()
+		s.render(diagnostics.Diagnostics, arg)
+		for _, token := range tokens {
+			fmt.Fprintf(s.stdout, "%-8v %s\n", token.Span, token.ToString())
+		}
+	case ":ast":
+		statements, err := s.parse(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(s.stdout, parser.NewAstPrinter().Print(statements))
+	case ":bytecode":
+		// compiled on its own, so globals of the session are not known
+		return s.dumpBytecode("", arg)
+	case ":env":
+		for _, name := range s.runtime.Globals() {
+			value, _ := s.runtime.GetGlobal(name)
+			fmt.Fprintf(s.stdout, "%s = %s\n", name, value)
+		}
+	case ":load":
+		if arg == "" {
+			return fmt.Errorf("usage: :load <file>")
+		}
+		if err := s.runtime.RunFile(context.Background(), arg); err != nil {
+			if e, ok := err.(*golox.Error); ok {
+				s.report(e)
+				return nil
+			}
+			return err
+		}
+	case ":reset":
+		s.runtime = s.newRuntime()
+	case ":time":
+		start := time.Now()
+		err := s.run(arg, true)
+		elapsed := time.Since(start)
+		// diagnostics have already been reported by the session
+		if err == nil {
+			fmt.Fprintf(s.stdout, "took %v\n", elapsed)
+		}
+	case ":help":
+		fmt.Fprintln(s.stdout, commandHelp)
+	default:
+		return fmt.Errorf("unknown command %s, type :help for a list", name)
+	}
+
+	return nil
+}
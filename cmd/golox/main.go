@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/maffkipp/golox"
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+)
+
+// config holds the command line options shared by scripts and the prompt
+type config struct {
+	// errorFormat is "human" or "json"
+	errorFormat string
+	// vm selects the bytecode virtual machine instead of the tree-walking
+	// interpreter
+	vm bool
+	// dumpBytecode prints the compiled script instead of running it
+	dumpBytecode bool
+}
+
+func main() {
+
+	var cfg config
+	flag.StringVar(&cfg.errorFormat, "error-format", "human", "print diagnostics in `format` human or json")
+	flag.BoolVar(&cfg.vm, "vm", false, "run the script on the bytecode virtual machine")
+	flag.BoolVar(&cfg.dumpBytecode, "dump-bytecode", false, "print the script's compiled bytecode instead of running it")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: golox [flags] [script]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if cfg.errorFormat != "human" && cfg.errorFormat != "json" {
+		flag.Usage()
+		os.Exit(64)
+	}
+
+	// the prompt always uses the tree-walking interpreter
+	if flag.NArg() > 1 || (cfg.vm || cfg.dumpBytecode) && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(64)
+	} else if flag.NArg() == 1 {
+		run := RunFile
+		if cfg.dumpBytecode {
+			run = DumpBytecode
+		} else if cfg.vm {
+			run = RunFileVM
+		}
+		err := run(flag.Arg(0), cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to run file:", err)
+			os.Exit(66)
+		}
+	} else {
+		err := RunPrompt(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read from prompt:", err)
+			os.Exit(74)
+		}
+	}
+}
+
+func RunFile(path string, cfg config) error {
+	s := newSession(cfg)
+	err := s.runtime.RunFile(context.Background(), path)
+
+	if e, ok := err.(*golox.Error); ok {
+		s.report(e)
+		if e.Runtime {
+			os.Exit(70)
+		}
+		os.Exit(65)
+	}
+	return err
+}
+
+// session holds the runtime shared by everything run from the prompt.
+// Program output and command results go to stdout, diagnostics to stderr.
+type session struct {
+	config
+	stdout  io.Writer
+	stderr  io.Writer
+	runtime *golox.Runtime
+}
+
+func newSession(cfg config) *session {
+	s := &session{config: cfg, stdout: os.Stdout, stderr: os.Stderr}
+	s.runtime = s.newRuntime()
+	return s
+}
+
+// Human readable diagnostics are rendered by the runtime as they are
+// found, while json is written from the returned error.
+func (s *session) newRuntime() *golox.Runtime {
+	opts := golox.Options{Stdout: s.stdout, Stderr: s.stderr}
+	if s.errorFormat == "json" {
+		opts.Stderr = io.Discard
+	}
+	return golox.New(opts)
+}
+
+// When echo is set, the value of a trailing expression statement is
+// printed unless it is nil, so typing "a + b;" at the prompt shows the result.
+// Ctrl-C stops a running script without leaving the prompt.
+func (s *session) run(source string, echo bool) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	value, err := s.runtime.Eval(ctx, source)
+	if e, ok := err.(*golox.Error); ok {
+		s.report(e)
+	} else if err == nil && echo && !value.IsNil() {
+		fmt.Fprintln(s.stdout, value)
+	}
+	return err
+}
+
+// parse is used by commands that inspect source without running it
+func (s *session) parse(source string) ([]parser.Stmt, error) {
+	diagnostics := &errors.Collector{}
+	defer s.render(diagnostics.Diagnostics, source)
+
+	tokens, hadErrors := lexer.NewScanner(source, diagnostics).ScanTokens()
+	if hadErrors {
+		return nil, fmt.Errorf("encountered errors while scanning")
+	}
+
+	statements, hadErrors := parser.NewParser(tokens, diagnostics).Parse()
+	if hadErrors {
+		return nil, fmt.Errorf("encountered errors while parsing")
+	}
+
+	return statements, nil
+}
+
+func (s *session) report(err *golox.Error) {
+	if s.errorFormat == "json" {
+		for _, d := range err.Diagnostics {
+			errors.WriteJSON(s.stderr, d)
+		}
+	}
+}
+
+func (s *session) render(diagnostics []errors.Diagnostic, source string) {
+	for _, d := range diagnostics {
+		if s.errorFormat == "json" {
+			errors.WriteJSON(s.stderr, d)
+		} else {
+			errors.Render(s.stderr, d, source, s.color())
+		}
+	}
+}
+
+func (s *session) color() bool {
+	if f, ok := s.stderr.(*os.File); ok {
+		return errors.ColorEnabled(f)
+	}
+	return false
+}
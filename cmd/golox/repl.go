@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maffkipp/golox/lexer"
+	"github.com/peterh/liner"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+func RunPrompt(cfg config) error {
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+
+	// one session for the whole prompt so definitions persist between lines
+	session := newSession(cfg)
+	line.SetWordCompleter(session.complete)
+
+	history := historyPath()
+	if f, err := os.Open(history); err == nil {
+		line.ReadHistory(f)
+		f.Close()
+	}
+	defer saveHistory(line, history)
+
+	// input accumulates lines until it forms a complete statement
+	input := ""
+	for {
+		p := prompt
+		if input != "" {
+			p = continuationPrompt
+		}
+
+		text, err := line.Prompt(p)
+		if err == io.EOF {
+			// Ctrl-D closes the repl, discarding any unfinished input
+			fmt.Println("")
+			break
+		} else if err == liner.ErrPromptAborted {
+			// Ctrl-C abandons the current input but keeps the session
+			input = ""
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// user can type "exit" to close repl
+		if input == "" && strings.TrimSpace(text) == "exit" {
+			break
+		}
+
+		if input == "" && strings.HasPrefix(strings.TrimSpace(text), ":") {
+			line.AppendHistory(text)
+			if err := session.command(strings.TrimSpace(text)); err != nil {
+				fmt.Fprintln(session.stderr, err)
+			}
+			continue
+		}
+
+		input += text + "\n"
+		if lexer.IsIncomplete(input) {
+			continue
+		}
+
+		if strings.TrimSpace(input) != "" {
+			// history is stored one entry per line, so fold multi-line input
+			line.AppendHistory(strings.Join(strings.Fields(input), " "))
+			// diagnostics are reported by the session
+			session.run(input, true)
+		}
+		input = ""
+	}
+
+	return nil
+}
+
+// complete offers keywords and global names matching the identifier
+// being typed at the cursor. liner gives pos in runes, so the line is
+// sliced as runes.
+func (s *session) complete(line string, pos int) (head string, completions []string, tail string) {
+	runes := []rune(line)
+	start := pos
+	for start > 0 && isIdentifierRune(runes[start-1]) {
+		start--
+	}
+
+	prefix := string(runes[start:pos])
+	if prefix == "" {
+		return string(runes[:pos]), nil, string(runes[pos:])
+	}
+
+	candidates := append(lexer.Keywords(), s.runtime.Globals()...)
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			completions = append(completions, candidate)
+		}
+	}
+
+	return string(runes[:start]), completions, string(runes[pos:])
+}
+
+func isIdentifierRune(char rune) bool {
+	return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+}
+
+// History lives in the user's config directory, falling back to the
+// working directory when none is available.
+func historyPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".golox_history"
+	}
+	return filepath.Join(dir, "golox", "history")
+}
+
+func saveHistory(line *liner.State, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	if f, err := os.Create(path); err == nil {
+		line.WriteHistory(f)
+		f.Close()
+	}
+}
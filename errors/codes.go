@@ -0,0 +1,49 @@
+package errors
+
+// Codes are stable across releases so tools can match on them instead
+// of on message text. They are grouped by the stage that reports them:
+// L00xx scanning, L01xx parsing, L02xx resolving, L03xx running and
+// L04xx compiling to bytecode.
+const (
+	UnterminatedString  Code = "L0001"
+	UnexpectedCharacter Code = "L0002"
+	InvalidNumber       Code = "L0003"
+
+	ExpectExpression        Code = "L0101"
+	ExpectSemicolon         Code = "L0102"
+	ExpectParen             Code = "L0103"
+	ExpectBrace             Code = "L0104"
+	ExpectName              Code = "L0105"
+	ExpectDot               Code = "L0106"
+	InvalidAssignmentTarget Code = "L0107"
+	TooManyParameters       Code = "L0108"
+	TooManyArguments        Code = "L0109"
+
+	ReadInOwnInitializer   Code = "L0201"
+	DuplicateVariable      Code = "L0202"
+	TopLevelReturn         Code = "L0203"
+	InitializerReturn      Code = "L0204"
+	ThisOutsideClass       Code = "L0205"
+	SuperOutsideClass      Code = "L0206"
+	SuperWithoutSuperclass Code = "L0207"
+	InheritFromSelf        Code = "L0208"
+
+	OperandType           Code = "L0301"
+	UndefinedVariable     Code = "L0302"
+	NotCallable           Code = "L0303"
+	ArityMismatch         Code = "L0304"
+	UndefinedProperty     Code = "L0305"
+	PropertyOnNonInstance Code = "L0306"
+	FieldOnNonInstance    Code = "L0307"
+	SuperclassNotClass    Code = "L0308"
+	NativeError           Code = "L0309"
+	StepLimit             Code = "L0310"
+	StackOverflow         Code = "L0311"
+	Cancelled             Code = "L0312"
+	AllocationLimit       Code = "L0313"
+
+	TooManyConstants Code = "L0401"
+	TooManyLocals    Code = "L0402"
+	TooManyUpvalues  Code = "L0403"
+	JumpTooLarge     Code = "L0404"
+)
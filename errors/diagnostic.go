@@ -0,0 +1,168 @@
+package errors
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maffkipp/golox/span"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Code identifies a kind of diagnostic independently of its wording
+type Code string
+
+// Diagnostic describes a problem found at a location in the source
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Span     span.Span
+	Message  string
+	Notes    []string
+	Help     string
+	// Stack holds the call stack of a runtime error, innermost first
+	Stack []Frame
+}
+
+// Frame is one active call: the function and the position reached in it,
+// which is empty for functions implemented in Go
+type Frame struct {
+	Function string
+	Span     span.Span
+}
+
+// TrimStack keeps the innermost and outermost frames of a deep stack,
+// where the middle is usually the same recursive call over and over. It
+// returns the number of frames left out.
+func TrimStack(stack []Frame) ([]Frame, int) {
+	const innermost, outermost = 20, 5
+	if len(stack) <= innermost+outermost {
+		return stack, 0
+	}
+	omitted := len(stack) - innermost - outermost
+	return append(stack[:innermost:innermost], stack[len(stack)-outermost:]...), omitted
+}
+
+func (f Frame) String() string {
+	if f.Span == (span.Span{}) {
+		return f.Function + " (native)"
+	}
+	return fmt.Sprintf("%s (%s)", f.Function, f.Span)
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorBold   = "\033[1m"
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorBlue   = "\033[34m"
+	colorCyan   = "\033[36m"
+)
+
+// Render writes d in the form
+//
+//	error: Expect ';' after value.
+//	 --> script.lox:3:12
+//	  |
+//	3 | print a + b
+//	  |         ^~~
+//
+// underlining the span on its first line. Notes, help and any stack
+// trace follow the excerpt. The excerpt is left out when source is
+// empty, as it is for code whose source is no longer known.
+func Render(w io.Writer, d Diagnostic, source string, color bool) {
+	paint := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + colorReset
+	}
+
+	label, labelColor := d.Severity.String(), colorRed
+	if d.Severity == SeverityWarning {
+		labelColor = colorYellow
+	}
+	if d.Code != "" {
+		label += "[" + string(d.Code) + "]"
+	}
+	fmt.Fprintf(w, "%s%s\n", paint(colorBold+labelColor, label), paint(colorBold, ": "+d.Message))
+
+	gutter := strings.Repeat(" ", len(fmt.Sprint(d.Span.Line)))
+	fmt.Fprintf(w, "%s%s %s\n", gutter, paint(colorBlue, "-->"), d.Span)
+
+	if text, ok := sourceLine(source, d.Span.Line); ok {
+		fmt.Fprintf(w, "%s %s\n", gutter, paint(colorBlue, "|"))
+		fmt.Fprintf(w, "%s %s %s\n", paint(colorBlue, fmt.Sprint(d.Span.Line)), paint(colorBlue, "|"), expandTabs(text))
+		fmt.Fprintf(w, "%s %s %s\n", gutter, paint(colorBlue, "|"), paint(labelColor, underline(text, d.Span, source)))
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s note: %s\n", gutter, paint(colorBlue, "="), note)
+	}
+	if d.Help != "" {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, paint(colorBlue, "="), paint(colorCyan, "help: "+d.Help))
+	}
+	if len(d.Stack) > 0 {
+		fmt.Fprintf(w, "%s %s stack trace:\n", gutter, paint(colorBlue, "="))
+		for _, frame := range d.Stack {
+			fmt.Fprintf(w, "%s       at %s\n", gutter, frame)
+		}
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if source == "" {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// underline places a caret under the first character of the span and
+// tildes under the rest of it, stopping at the end of the line.
+func underline(text string, sp span.Span, source string) string {
+	var b strings.Builder
+
+	prefix := []rune(text)
+	if sp.Column-1 < len(prefix) {
+		prefix = prefix[:sp.Column-1]
+	}
+	for _, char := range prefix {
+		if char == '\t' {
+			b.WriteString("    ")
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	width := 1
+	if sp.End > sp.Start && sp.End <= len(source) {
+		spanned, _, _ := strings.Cut(source[sp.Start:sp.End], "\n")
+		width = max(utf8.RuneCountInString(spanned), 1)
+	}
+
+	b.WriteByte('^')
+	b.WriteString(strings.Repeat("~", width-1))
+	return b.String()
+}
+
+func expandTabs(text string) string {
+	return strings.ReplaceAll(text, "\t", "    ")
+}
@@ -2,16 +2,48 @@ package errors
 
 import (
 	"fmt"
+	"os"
 )
 
-func Error(line int, message string) {
-	Report(line, "", message)
+// Sink receives diagnostics as the scanner, parser, resolver and
+// interpreter find them.
+type Sink interface {
+	Report(d Diagnostic)
 }
 
-func Report(line int, where string, message string) {
-	fmt.Print(LoxErrorFmt(line, where, message))
+// Collector is a Sink that keeps every diagnostic reported to it
+type Collector struct {
+	Diagnostics []Diagnostic
+}
+
+func (c *Collector) Report(d Diagnostic) {
+	c.Diagnostics = append(c.Diagnostics, d)
+}
+
+func (c *Collector) HasErrors() bool {
+	for _, d := range c.Diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset discards the collected diagnostics so the collector can be reused
+func (c *Collector) Reset() {
+	c.Diagnostics = nil
 }
 
 func LoxErrorFmt(line int, where string, message string) string {
 	return fmt.Sprintf("[line %d] Error%s: %s\n", line, where, message)
 }
+
+// ColorEnabled reports whether output written to f should be colored,
+// which is when f is a terminal and NO_COLOR is unset.
+func ColorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
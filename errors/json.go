@@ -0,0 +1,53 @@
+package errors
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonSpan struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Start  int `json:"start"`
+	End    int `json:"end"`
+}
+
+type jsonFrame struct {
+	Function string   `json:"function"`
+	File     string   `json:"file"`
+	Span     jsonSpan `json:"span"`
+}
+
+type jsonDiagnostic struct {
+	Code     Code        `json:"code"`
+	Severity string      `json:"severity"`
+	File     string      `json:"file"`
+	Span     jsonSpan    `json:"span"`
+	Message  string      `json:"message"`
+	Notes    []string    `json:"notes,omitempty"`
+	Help     string      `json:"help,omitempty"`
+	Stack    []jsonFrame `json:"stack,omitempty"`
+}
+
+// WriteJSON writes d as a single line JSON object such as
+//
+//	{"code":"L0102","severity":"error","file":"a.lox","span":{...},"message":"..."}
+func WriteJSON(w io.Writer, d Diagnostic) error {
+	out := jsonDiagnostic{
+		Code:     d.Code,
+		Severity: d.Severity.String(),
+		File:     d.Span.File,
+		Span:     jsonSpan{d.Span.Line, d.Span.Column, d.Span.Start, d.Span.End},
+		Message:  d.Message,
+		Notes:    d.Notes,
+		Help:     d.Help,
+	}
+	for _, frame := range d.Stack {
+		sp := frame.Span
+		out.Stack = append(out.Stack, jsonFrame{frame.Function, sp.File, jsonSpan{sp.Line, sp.Column, sp.Start, sp.End}})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(out)
+}
@@ -0,0 +1,279 @@
+// Package golox embeds the Lox interpreter in Go programs.
+//
+// A Runtime keeps its global environment between calls, so definitions
+// made by one Eval are visible to the next:
+//
+//	rt := golox.New(golox.Options{Stdout: &out})
+//	rt.Eval(ctx, "fun double(n) { return n * 2; }")
+//	result, err := rt.Call(ctx, "double", 21.0)
+package golox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/value"
+)
+
+// Options configures a Runtime. Nil streams default to the process's
+// standard streams.
+type Options struct {
+	// Stdin is made available to host functions through Runtime.Stdin
+	Stdin io.Reader
+	// Stdout receives the output of print statements
+	Stdout io.Writer
+	// Stderr receives diagnostics rendered for humans. Use io.Discard
+	// to rely only on the diagnostics carried by returned errors.
+	Stderr io.Writer
+	// MaxSteps bounds the statements and expressions evaluated by each
+	// Eval, RunFile or Call. Zero means unlimited.
+	MaxSteps int
+	// MaxCallDepth bounds the nesting of calls. Zero means
+	// parser.DefaultMaxCallDepth.
+	MaxCallDepth int
+	// MaxAllocation bounds the bytes a run may allocate for strings,
+	// instances, lists, maps, scopes, variables and functions, using
+	// approximate sizes. Allocations are counted as they happen and never
+	// credited back when values become unreachable, so this bounds the
+	// total a run allocates rather than the memory it holds at once.
+	// Zero means unlimited.
+	MaxAllocation int
+}
+
+// Runtime runs Lox source against a persistent global environment.
+// A Runtime is not safe for concurrent use.
+type Runtime struct {
+	stdin       io.Reader
+	stdout      io.Writer
+	stderr      io.Writer
+	interpreter *parser.Interpreter
+	diagnostics *errors.Collector
+	// sources holds the text of the last maxSources files and Evals run,
+	// so diagnostics can quote code defined by an earlier Eval. order
+	// lists their names, oldest first.
+	sources map[string]string
+	order   []string
+	evals   int
+	// classes given to instances marshaled from each struct type
+	classes map[reflect.Type]*parser.LoxClass
+	// depth is the nesting of the value being unmarshaled
+	depth int
+	// marshaling holds the pointers, maps and slices enclosing the value
+	// being marshaled
+	marshaling map[reference]bool
+}
+
+// Error is returned when source fails to compile or run. It carries
+// every diagnostic reported along the way.
+type Error struct {
+	// Runtime is set when the failure happened while running rather
+	// than while scanning, parsing or resolving
+	Runtime     bool
+	Diagnostics []errors.Diagnostic
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = fmt.Sprintf("%s: %s", d.Span, d.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// maxSources bounds the source text kept for diagnostics. Errors in code
+// from older sources are reported without quoting it.
+const maxSources = 64
+
+func New(opts Options) *Runtime {
+	r := &Runtime{stdin: opts.Stdin, stdout: opts.Stdout, stderr: opts.Stderr, diagnostics: &errors.Collector{}, sources: map[string]string{}, classes: map[reflect.Type]*parser.LoxClass{}, marshaling: map[reference]bool{}}
+	if r.stdin == nil {
+		r.stdin = os.Stdin
+	}
+	if r.stdout == nil {
+		r.stdout = os.Stdout
+	}
+	if r.stderr == nil {
+		r.stderr = os.Stderr
+	}
+
+	r.interpreter = parser.NewInterpreter(r.diagnostics)
+	r.interpreter.SetOutput(r.stdout)
+
+	limits := parser.Limits{MaxSteps: opts.MaxSteps, MaxCallDepth: opts.MaxCallDepth, MaxAllocation: opts.MaxAllocation}
+	if limits.MaxCallDepth == 0 {
+		limits.MaxCallDepth = parser.DefaultMaxCallDepth
+	}
+	r.interpreter.SetLimits(limits)
+	return r
+}
+
+// Stdin, Stdout and Stderr return the streams the Runtime was configured
+// with, for use by native functions
+func (r *Runtime) Stdin() io.Reader {
+	return r.stdin
+}
+
+func (r *Runtime) Stdout() io.Writer {
+	return r.stdout
+}
+
+func (r *Runtime) Stderr() io.Writer {
+	return r.stderr
+}
+
+// Eval runs source and returns the value of its final statement when
+// that is an expression statement, or value.Nil otherwise. Diagnostics
+// name the source "<eval-N>" for the Nth call. When ctx is done the
+// script is stopped with a runtime error.
+func (r *Runtime) Eval(ctx context.Context, source string) (value.Value, error) {
+	r.evals++
+	return r.eval(ctx, fmt.Sprintf("<eval-%d>", r.evals), source)
+}
+
+// RunFile runs the script at path, naming it in diagnostics
+func (r *Runtime) RunFile(ctx context.Context, path string) error {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = r.eval(ctx, path, string(bytes))
+	return err
+}
+
+// SetGlobal defines or redefines a global variable, converting v with
+// Marshal
+func (r *Runtime) SetGlobal(name string, v any) error {
+	val, err := r.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// natives made from Go funcs are known by the name scripts call them.
+	// Natives passed in as values may be known elsewhere and keep theirs.
+	if native, ok := value.As[*parser.NativeFunction](val); ok && reflect.ValueOf(v).Kind() == reflect.Func {
+		native.Name = name
+	}
+	r.interpreter.Globals().Define(name, val)
+	return nil
+}
+
+func (r *Runtime) GetGlobal(name string) (value.Value, bool) {
+	return r.interpreter.Globals().Lookup(name)
+}
+
+// Globals returns the names of all global variables in sorted order
+func (r *Runtime) Globals() []string {
+	return r.interpreter.Globals().Names()
+}
+
+// AllocatedBytes returns the bytes allocated during the last Eval,
+// RunFile or Call, counted as for Options.MaxAllocation
+func (r *Runtime) AllocatedBytes() int {
+	return r.interpreter.AllocatedBytes()
+}
+
+// RegisterNative exposes a Go function to scripts as a global. A
+// non-nil error from fn is raised as a Lox runtime error at the call.
+func (r *Runtime) RegisterNative(name string, arity int, fn func(args []value.Value) (value.Value, error)) {
+	r.interpreter.RegisterNative(name, arity, fn)
+}
+
+// Call invokes the global function or class called name with args
+// converted by Marshal. The result is returned as a Lox value.
+func (r *Runtime) Call(ctx context.Context, name string, args ...any) (value.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return value.Nil, err
+	}
+
+	global, ok := r.GetGlobal(name)
+	if !ok {
+		return value.Nil, fmt.Errorf("golox: undefined function %q", name)
+	}
+
+	callable, ok := value.As[parser.LoxCallable](global)
+	if !ok {
+		return value.Nil, fmt.Errorf("golox: %q is not a function or class", name)
+	}
+
+	if len(args) != callable.Arity() {
+		return value.Nil, fmt.Errorf("golox: %q expects %d arguments but got %d", name, callable.Arity(), len(args))
+	}
+
+	arguments := make([]value.Value, len(args))
+	for i, arg := range args {
+		val, err := r.Marshal(arg)
+		if err != nil {
+			return value.Nil, err
+		}
+		arguments[i] = val
+	}
+
+	result, hadErrors := r.interpreter.Call(ctx, callable, arguments)
+	if hadErrors {
+		return value.Nil, r.fail(true)
+	}
+	return result, nil
+}
+
+func (r *Runtime) eval(ctx context.Context, file string, source string) (value.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return value.Nil, err
+	}
+
+	r.addSource(file, source)
+
+	tokens, hadErrors := lexer.NewFileScanner(file, source, r.diagnostics).ScanTokens()
+	if hadErrors {
+		return value.Nil, r.fail(false)
+	}
+
+	statements, hadErrors := parser.NewParser(tokens, r.diagnostics).Parse()
+	if hadErrors {
+		return value.Nil, r.fail(false)
+	}
+
+	if hadErrors := parser.NewResolver(r.interpreter, r.diagnostics).Resolve(statements); hadErrors {
+		return value.Nil, r.fail(false)
+	}
+
+	result, hadErrors := r.interpreter.Run(ctx, statements)
+	if hadErrors {
+		return value.Nil, r.fail(true)
+	}
+	return result, nil
+}
+
+func (r *Runtime) addSource(file string, source string) {
+	if _, ok := r.sources[file]; !ok {
+		r.order = append(r.order, file)
+	}
+	r.sources[file] = source
+
+	if len(r.order) > maxSources {
+		delete(r.sources, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// fail renders the collected diagnostics to stderr and moves them into
+// the returned error.
+func (r *Runtime) fail(runtime bool) *Error {
+	color := false
+	if f, ok := r.stderr.(*os.File); ok {
+		color = errors.ColorEnabled(f)
+	}
+
+	for _, d := range r.diagnostics.Diagnostics {
+		errors.Render(r.stderr, d, r.sources[d.Span.File], color)
+	}
+
+	err := &Error{Runtime: runtime, Diagnostics: r.diagnostics.Diagnostics}
+	r.diagnostics.Reset()
+	return err
+}
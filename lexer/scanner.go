@@ -2,9 +2,12 @@ package lexer
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/span"
 )
 
 var keywords = map[string]TokenType{
@@ -26,16 +29,50 @@ var keywords = map[string]TokenType{
 	"while":  WHILE,
 }
 
+// Keywords returns the reserved words of the language in sorted order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// scanError pairs a scanning error with its diagnostic code
+type scanError struct {
+	code    errors.Code
+	message string
+}
+
+func (e *scanError) Error() string {
+	return e.message
+}
+
+var errUnterminatedString = &scanError{errors.UnterminatedString, "unterminated string"}
+
 type Scanner struct {
+	sink    errors.Sink
+	file    string
 	source  string
 	tokens  []Token
 	start   int
 	current int
 	line    int
+	// column of the rune at current, counted in runes from 1
+	column int
+	// position of the lexeme being scanned
+	startLine   int
+	startColumn int
 }
 
-func NewScanner(source string) *Scanner {
-	return &Scanner{source, []Token{}, 0, 0, 1}
+func NewScanner(source string, sink errors.Sink) *Scanner {
+	return NewFileScanner("", source, sink)
+}
+
+// NewFileScanner records file on the span of every token it produces
+func NewFileScanner(file string, source string, sink errors.Sink) *Scanner {
+	return &Scanner{sink: sink, file: file, source: source, tokens: []Token{}, line: 1, column: 1}
 }
 
 func (s *Scanner) ScanTokens() (tokens []Token, hadErrors bool) {
@@ -44,19 +81,50 @@ func (s *Scanner) ScanTokens() (tokens []Token, hadErrors bool) {
 
 	for !s.isAtEnd() {
 		// We are at the beginning of the next lexeme.
-		s.start = s.current
+		s.beginLexeme()
 
 		if err := s.scanToken(); err != nil {
-			errors.Error(s.line, err.Error())
+			s.sink.Report(errors.Diagnostic{Code: err.code, Span: s.span(), Message: err.message})
 			hadErrors = true
 		}
 	}
 
-	s.tokens = append(s.tokens, *NewToken(EOF, "", nil, s.line))
-	return s.tokens, false
+	s.beginLexeme()
+	s.tokens = append(s.tokens, *NewToken(EOF, "", nil, s.span()))
+	return s.tokens, hadErrors
 }
 
-func (s *Scanner) scanToken() error {
+// IsIncomplete reports whether source stops inside a string or with
+// unclosed parentheses or braces, meaning more input is expected.
+// Other scanning errors are left for ScanTokens to report.
+func IsIncomplete(source string) bool {
+	s := NewScanner(source, &errors.Collector{})
+
+	for !s.isAtEnd() {
+		s.beginLexeme()
+		if err := s.scanToken(); err == errUnterminatedString {
+			return true
+		}
+	}
+
+	parens, braces := 0, 0
+	for _, token := range s.tokens {
+		switch token.TokenType {
+		case LEFT_PAREN:
+			parens++
+		case RIGHT_PAREN:
+			parens--
+		case LEFT_BRACE:
+			braces++
+		case RIGHT_BRACE:
+			braces--
+		}
+	}
+
+	return parens > 0 || braces > 0
+}
+
+func (s *Scanner) scanToken() *scanError {
 	char := s.advance()
 	switch char {
 	case '(':
@@ -97,7 +165,7 @@ func (s *Scanner) scanToken() error {
 			s.addToken(SLASH)
 		}
 	case '\n':
-		s.line++
+		s.newline()
 	// Do nothing for whitespace
 	case ' ':
 	case '\r':
@@ -116,7 +184,7 @@ func (s *Scanner) scanToken() error {
 				return err
 			}
 		} else {
-			return fmt.Errorf("unexpected character %s", string(char))
+			return &scanError{errors.UnexpectedCharacter, fmt.Sprintf("unexpected character %s", string(char))}
 		}
 	}
 	return nil
@@ -125,9 +193,18 @@ func (s *Scanner) scanToken() error {
 func (s *Scanner) advance() byte {
 	char := s.source[s.current]
 	s.current++
+	s.countColumn(char)
 	return char
 }
 
+// countColumn moves the column past char unless it continues a
+// multi-byte rune
+func (s *Scanner) countColumn(char byte) {
+	if utf8.RuneStart(char) {
+		s.column++
+	}
+}
+
 func (s *Scanner) peek() byte {
 	if s.isAtEnd() {
 		return 0
@@ -148,7 +225,24 @@ func (s *Scanner) addToken(t TokenType) {
 
 func (s *Scanner) addTokenWithLiteral(t TokenType, literal any) {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, *NewToken(t, text, literal, s.line))
+	s.tokens = append(s.tokens, *NewToken(t, text, literal, s.span()))
+}
+
+func (s *Scanner) beginLexeme() {
+	s.start = s.current
+	s.startLine = s.line
+	s.startColumn = s.column
+}
+
+// newline is called after consuming a '\n'
+func (s *Scanner) newline() {
+	s.line++
+	s.column = 1
+}
+
+// span covers the lexeme scanned since the last call to beginLexeme
+func (s *Scanner) span() span.Span {
+	return span.Span{File: s.file, Line: s.startLine, Column: s.startColumn, Start: s.start, End: s.current}
 }
 
 func (s *Scanner) addTokenOnCondition(condition bool, ifTrue TokenType, ifFalse TokenType) {
@@ -168,22 +262,21 @@ func (s *Scanner) match(expected byte) bool {
 		return false
 	}
 	s.current++
+	s.countColumn(expected)
 	return true
 }
 
-func (s *Scanner) string() error {
+func (s *Scanner) string() *scanError {
 	for s.peek() != '"' && !s.isAtEnd() {
 
 		// Lox supports multiline strings
-		if s.peek() == '\n' {
-			s.line++
+		if s.advance() == '\n' {
+			s.newline()
 		}
-
-		s.advance()
 	}
 
 	if s.isAtEnd() {
-		return fmt.Errorf("unterminated string")
+		return errUnterminatedString
 	}
 
 	// Account for closing quote
@@ -195,14 +288,16 @@ func (s *Scanner) string() error {
 	return nil
 }
 
-func (s *Scanner) number() error {
+func (s *Scanner) number() *scanError {
 	for isDigit(s.peek()) {
 		s.advance()
 	}
 
 	// Look for a decimal
 	if s.peek() == '.' && isDigit(s.peekNext()) {
-		// discard decimal
+		// consume the "."
+		s.advance()
+
 		for isDigit(s.peek()) {
 			s.advance()
 		}
@@ -210,14 +305,14 @@ func (s *Scanner) number() error {
 
 	num, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
 	if err != nil {
-		return fmt.Errorf("unable to parse number")
+		return &scanError{errors.InvalidNumber, "unable to parse number"}
 	}
 
 	s.addTokenWithLiteral(NUMBER, num)
 	return nil
 }
 
-func (s *Scanner) identifier() error {
+func (s *Scanner) identifier() *scanError {
 	for isAlphaNumeric(s.peek()) {
 		s.advance()
 	}
@@ -1,16 +1,20 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/maffkipp/golox/span"
+)
 
 type Token struct {
 	TokenType TokenType
 	Lexeme    string
 	Literal   any
-	Line      int
+	Span      span.Span
 }
 
-func NewToken(tokenType TokenType, lexeme string, literal any, line int) *Token {
-	return &Token{tokenType, lexeme, literal, line}
+func NewToken(tokenType TokenType, lexeme string, literal any, sp span.Span) *Token {
+	return &Token{tokenType, lexeme, literal, sp}
 }
 
 func (t *Token) ToString() string {
@@ -0,0 +1,173 @@
+package golox
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/value"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		source string
+		// code is the runtime error the source must stop with, if any
+		code errors.Code
+	}{
+		{
+			name:   "steps within budget",
+			opts:   Options{MaxSteps: 1000},
+			source: "var i = 0; while (i < 10) i = i + 1;",
+		},
+		{
+			name:   "steps exhausted",
+			opts:   Options{MaxSteps: 1000},
+			source: "while (true) {}",
+			code:   errors.StepLimit,
+		},
+		{
+			name:   "steps exhausted by a trailing expression",
+			opts:   Options{MaxSteps: 1000},
+			source: "fun loop() { while (true) {} } loop();",
+			code:   errors.StepLimit,
+		},
+		{
+			name:   "calls within depth",
+			opts:   Options{MaxCallDepth: 50},
+			source: "fun f(n) { if (n > 0) f(n - 1); } f(49);",
+		},
+		{
+			name:   "calls too deep",
+			opts:   Options{MaxCallDepth: 50},
+			source: "fun f(n) { if (n > 0) f(n - 1); } f(50);",
+			code:   errors.StackOverflow,
+		},
+		{
+			name:   "unbounded recursion at the default depth",
+			source: "fun f() { f(); } f();",
+			code:   errors.StackOverflow,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.opts.Stdout, test.opts.Stderr = io.Discard, io.Discard
+			r := New(test.opts)
+			_, err := r.Eval(context.Background(), test.source)
+			if test.code == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if code := errorCode(t, err); code != test.code {
+				t.Errorf("failed with %q, want %q", code, test.code)
+			}
+		})
+	}
+}
+
+// An Eval's statements and its trailing expression share one budget,
+// which starts afresh for the next Eval or Call
+func TestStepBudgetPerRun(t *testing.T) {
+	// a call to loop takes about 1000 steps
+	r := New(Options{Stdout: io.Discard, Stderr: io.Discard, MaxSteps: 1500})
+	ctx := context.Background()
+	if _, err := r.Eval(ctx, "fun loop() { for (var i = 0; i < 100; i = i + 1) {} }"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Eval(ctx, "loop();"); err != nil {
+		t.Fatalf("one loop: %v", err)
+	}
+	if _, err := r.Eval(ctx, "loop();"); err != nil {
+		t.Fatalf("one loop in the next Eval: %v", err)
+	}
+	if _, err := r.Call(ctx, "loop"); err != nil {
+		t.Fatalf("one loop in a Call: %v", err)
+	}
+
+	// the second call is the trailing expression, whose value Eval returns
+	_, err := r.Eval(ctx, "loop(); loop();")
+	if code := errorCode(t, err); code != errors.StepLimit {
+		t.Errorf("two loops failed with %q, want %q", code, errors.StepLimit)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	r := New(Options{Stdout: io.Discard, Stderr: io.Discard})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.RegisterNative("cancel", 0, func(arguments []value.Value) (value.Value, error) {
+		cancel()
+		return value.Nil, nil
+	})
+	_, err := r.Eval(ctx, "cancel(); while (true) {}")
+	if code := errorCode(t, err); code != errors.Cancelled {
+		t.Errorf("failed with %q, want %q", code, errors.Cancelled)
+	}
+
+	// a context already done stops the run before it starts
+	if _, err := r.Eval(ctx, "print 1;"); err != context.Canceled {
+		t.Errorf("Eval with a cancelled context returned %v", err)
+	}
+	if _, err := r.Call(ctx, "clock"); err != context.Canceled {
+		t.Errorf("Call with a cancelled context returned %v", err)
+	}
+}
+
+func TestMaxAllocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"strings", `var s = "ab"; while (true) s = s + s;`},
+		{"list elements", "while (true) list.append(1);"},
+		{"map entries", "var i = 0; while (true) { map.set(i, i); i = i + 1; }"},
+		{"map keys", "map.set(1, 1); while (true) map.keys();"},
+		{"instances", "class A {} while (true) A();"},
+		{"fields", "class A {} while (true) A().field = 1;"},
+		{"variables", "while (true) { var x = 1; }"},
+		{"calls", "fun f() {} while (true) f();"},
+		{"closures", "while (true) { fun f() {} }"},
+		{"bound methods", "class A { m() {} } var a = A(); while (true) a.m;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := New(Options{Stdout: io.Discard, Stderr: io.Discard, MaxAllocation: 1000})
+			if err := r.SetGlobal("list", []any{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SetGlobal("map", map[any]any{}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := r.Eval(context.Background(), test.source)
+			if code := errorCode(t, err); code != errors.AllocationLimit {
+				t.Errorf("failed with %q, want %q", code, errors.AllocationLimit)
+			}
+			if allocated := r.AllocatedBytes(); allocated <= 1000 {
+				t.Errorf("AllocatedBytes() = %d after passing the limit", allocated)
+			}
+		})
+	}
+}
+
+func TestAllocatedBytes(t *testing.T) {
+	r := New(Options{Stdout: io.Discard, Stderr: io.Discard, MaxAllocation: 1000})
+	if _, err := r.Eval(context.Background(), `var s = "a" + "b";`); err != nil {
+		t.Fatal(err)
+	}
+	if allocated := r.AllocatedBytes(); allocated == 0 || allocated > 1000 {
+		t.Errorf("AllocatedBytes() = %d", allocated)
+	}
+
+	// each run is counted on its own
+	for i := 0; i < 100; i++ {
+		if _, err := r.Eval(context.Background(), `s = "a" + "b";`); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+}
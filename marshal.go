@@ -0,0 +1,570 @@
+package golox
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/value"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// maxDepth bounds the nesting of values converted between Go and Lox, so
+// that a list containing itself fails instead of exhausting the stack
+const maxDepth = 1000
+
+var errTooDeep = fmt.Errorf("value nested more than %d deep, or cyclic", maxDepth)
+
+// within adds the position inside a value to err, except to errTooDeep,
+// which would otherwise repeat it at every level
+func within(err error, format string, args ...any) error {
+	if err == errTooDeep {
+		return err
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// Marshal converts a Go value into a Lox value:
+//
+//   - nil, bools, strings and numbers become values of the same kind
+//   - slices and arrays become lists and maps become maps
+//   - structs and pointers to structs become instances holding a copy of
+//     their exported fields
+//   - funcs become native functions, with a trailing error result raised
+//     as a runtime error
+//
+// Values and Lox objects are returned unchanged. Struct fields keep
+// their Go name unless tagged `lox:"name"`; fields tagged `lox:"-"` are
+// left out.
+func (r *Runtime) Marshal(v any) (value.Value, error) {
+	val, err := r.marshal(reflect.ValueOf(v))
+	if err != nil {
+		return value.Nil, fmt.Errorf("golox: %w", err)
+	}
+	return val, nil
+}
+
+// Unmarshal stores a Lox value in the Go value target points to, using
+// the same correspondence as Marshal. A value.Value target receives the
+// value unchanged. Into an empty interface numbers become float64, lists
+// []any, maps map[any]any and instances map[string]any. Lox
+// functions become Go funcs that call back into the runtime, within the
+// limits of the run in progress if there is one; a runtime error is
+// returned through the func's trailing error result, or panics when it
+// has none.
+func (r *Runtime) Unmarshal(val value.Value, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("golox: Unmarshal needs a non-nil pointer, got %T", target)
+	}
+	if err := r.unmarshal(val, v.Elem()); err != nil {
+		return fmt.Errorf("golox: %w", err)
+	}
+	return nil
+}
+
+func (r *Runtime) marshal(v reflect.Value) (value.Value, error) {
+	if !v.IsValid() {
+		return value.Nil, nil
+	}
+
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case value.Value:
+			return x, nil
+		case parser.LoxCallable, *parser.LoxInstance, *parser.LoxList, *parser.LoxMap:
+			if object, ok := x.(value.Object); ok {
+				return value.Obj(object), nil
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return value.Bool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Number(float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Number(float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Number(v.Float()), nil
+	case reflect.String:
+		return value.String(v.String()), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return value.Nil, nil
+		}
+		return r.marshal(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return value.Nil, nil
+		}
+		if err := r.enter(v); err != nil {
+			return value.Nil, err
+		}
+		defer r.leave(v)
+		return r.marshal(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return value.Nil, nil
+			}
+			if err := r.enter(v); err != nil {
+				return value.Nil, err
+			}
+			defer r.leave(v)
+		}
+		elements := make([]value.Value, v.Len())
+		for i := range elements {
+			element, err := r.marshal(v.Index(i))
+			if err != nil {
+				return value.Nil, err
+			}
+			elements[i] = element
+		}
+		return value.Obj(parser.NewLoxList(elements)), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return value.Nil, nil
+		}
+		if err := r.enter(v); err != nil {
+			return value.Nil, err
+		}
+		defer r.leave(v)
+		entries := make(map[value.Value]value.Value, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := r.marshal(iter.Key())
+			if err != nil {
+				return value.Nil, err
+			}
+			if key.IsNil() {
+				return value.Nil, fmt.Errorf("cannot marshal nil key of %s", v.Type())
+			}
+			element, err := r.marshal(iter.Value())
+			if err != nil {
+				return value.Nil, err
+			}
+			entries[key] = element
+		}
+		return value.Obj(parser.NewLoxMap(entries)), nil
+	case reflect.Struct:
+		instance := parser.NewLoxInstance(r.class(v.Type()))
+		for _, field := range structFields(v.Type()) {
+			// fields promoted through a nil embedded pointer are left out
+			f, err := v.FieldByIndexErr(field.index)
+			if err != nil {
+				continue
+			}
+			val, err := r.marshal(f)
+			if err != nil {
+				return value.Nil, fmt.Errorf("field %s: %w", field.name, err)
+			}
+			instance.Fields()[field.name] = val
+		}
+		return value.Obj(instance), nil
+	case reflect.Func:
+		if v.IsNil() {
+			return value.Nil, nil
+		}
+		return r.marshalFunc(v)
+	}
+	return value.Nil, fmt.Errorf("cannot marshal %s", v.Type())
+}
+
+// reference identifies a pointer, map or slice. Slices sharing an array
+// are told apart by their length.
+type reference struct {
+	t      reflect.Type
+	ptr    uintptr
+	length int
+}
+
+func referenceTo(v reflect.Value) reference {
+	ref := reference{t: v.Type(), ptr: v.Pointer()}
+	if v.Kind() == reflect.Slice {
+		ref.length = v.Len()
+	}
+	return ref
+}
+
+// enter records that v is being marshaled, failing if it already is
+// further out, which means v contains itself
+func (r *Runtime) enter(v reflect.Value) error {
+	ref := referenceTo(v)
+	if r.marshaling[ref] {
+		return fmt.Errorf("cannot marshal cyclic %s", v.Type())
+	}
+	r.marshaling[ref] = true
+	return nil
+}
+
+func (r *Runtime) leave(v reflect.Value) {
+	delete(r.marshaling, referenceTo(v))
+}
+
+// class returns the class given to instances made from structs of type t,
+// so that every value of one type shares a class
+func (r *Runtime) class(t reflect.Type) *parser.LoxClass {
+	if class, ok := r.classes[t]; ok {
+		return class
+	}
+	name := t.Name()
+	if name == "" {
+		name = "struct"
+	}
+	class := parser.NewLoxClass(name, nil, map[string]*parser.LoxFunction{})
+	r.classes[t] = class
+	return class
+}
+
+func (r *Runtime) marshalFunc(v reflect.Value) (value.Value, error) {
+	t := v.Type()
+	if t.IsVariadic() {
+		return value.Nil, fmt.Errorf("cannot marshal variadic %s", t)
+	}
+	if t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != errorType {
+		return value.Nil, fmt.Errorf("cannot marshal %s: results must be a value, an error or both", t)
+	}
+
+	name := runtime.FuncForPC(v.Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+
+	native := parser.NewNativeFunction(name, t.NumIn(), func(arguments []value.Value) (value.Value, error) {
+		in := make([]reflect.Value, len(arguments))
+		for i, argument := range arguments {
+			in[i] = reflect.New(t.In(i)).Elem()
+			if err := r.unmarshal(argument, in[i]); err != nil {
+				return value.Nil, fmt.Errorf("argument %d: %w", i+1, err)
+			}
+		}
+
+		out := v.Call(in)
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return value.Nil, err
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return value.Nil, nil
+		}
+		return r.marshal(out[0])
+	})
+	return value.Obj(native), nil
+}
+
+var valueType = reflect.TypeOf(value.Value{})
+
+func (r *Runtime) unmarshal(val value.Value, v reflect.Value) error {
+	if r.depth >= maxDepth {
+		return errTooDeep
+	}
+	r.depth++
+	defer func() { r.depth-- }()
+
+	if v.Type() == valueType {
+		v.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if val.IsNil() {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		n, err := natural(val, 0)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(n))
+		return nil
+	}
+	if val.IsObject() && reflect.TypeOf(val.AsObject()).AssignableTo(v.Type()) {
+		v.Set(reflect.ValueOf(val.AsObject()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return r.unmarshal(val, v.Elem())
+	case reflect.Bool:
+		if val.IsBool() {
+			v.SetBool(val.AsBool())
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if val.IsNumber() {
+			n := val.AsNumber()
+			// compared as floats, since converting out of range numbers
+			// gives arbitrary results
+			limit := math.Ldexp(1, v.Type().Bits()-1)
+			if n != math.Trunc(n) || n < -limit || n >= limit {
+				return fmt.Errorf("cannot unmarshal %s into %s", val, v.Type())
+			}
+			v.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if val.IsNumber() {
+			n := val.AsNumber()
+			if n != math.Trunc(n) || n < 0 || n >= math.Ldexp(1, v.Type().Bits()) {
+				return fmt.Errorf("cannot unmarshal %s into %s", val, v.Type())
+			}
+			v.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if val.IsNumber() {
+			v.SetFloat(val.AsNumber())
+			return nil
+		}
+	case reflect.String:
+		if val.IsString() {
+			v.SetString(val.AsString())
+			return nil
+		}
+	case reflect.Slice:
+		if list, ok := value.As[*parser.LoxList](val); ok {
+			slice := reflect.MakeSlice(v.Type(), len(list.Elements), len(list.Elements))
+			for i, element := range list.Elements {
+				if err := r.unmarshal(element, slice.Index(i)); err != nil {
+					return within(err, "element %d", i)
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if list, ok := value.As[*parser.LoxList](val); ok {
+			if len(list.Elements) != v.Len() {
+				return fmt.Errorf("cannot unmarshal list of length %d into %s", len(list.Elements), v.Type())
+			}
+			for i, element := range list.Elements {
+				if err := r.unmarshal(element, v.Index(i)); err != nil {
+					return within(err, "element %d", i)
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if entries, ok := mapEntries(val); ok {
+			m := reflect.MakeMapWithSize(v.Type(), len(entries))
+			for key, element := range entries {
+				k := reflect.New(v.Type().Key()).Elem()
+				if err := r.unmarshal(key, k); err != nil {
+					return within(err, "key %s", key)
+				}
+				if !k.Comparable() {
+					return fmt.Errorf("cannot use %s key as a key of %s", typeName(key), v.Type())
+				}
+				e := reflect.New(v.Type().Elem()).Elem()
+				if err := r.unmarshal(element, e); err != nil {
+					return within(err, "key %s", key)
+				}
+				m.SetMapIndex(k, e)
+			}
+			v.Set(m)
+			return nil
+		}
+	case reflect.Struct:
+		if entries, ok := mapEntries(val); ok {
+			for _, field := range structFields(v.Type()) {
+				element, ok := entries[value.String(field.name)]
+				if !ok {
+					continue
+				}
+				f, err := v.FieldByIndexErr(field.index)
+				if err != nil {
+					continue
+				}
+				if err := r.unmarshal(element, f); err != nil {
+					return within(err, "field %s", field.name)
+				}
+			}
+			return nil
+		}
+	case reflect.Func:
+		if callable, ok := value.As[parser.LoxCallable](val); ok {
+			return r.unmarshalFunc(callable, v)
+		}
+	}
+	return fmt.Errorf("cannot unmarshal %s into %s", typeName(val), v.Type())
+}
+
+func (r *Runtime) unmarshalFunc(callable parser.LoxCallable, v reflect.Value) error {
+	t := v.Type()
+	if t.IsVariadic() || t.NumIn() != callable.Arity() {
+		return fmt.Errorf("cannot unmarshal function of arity %d into %s", callable.Arity(), t)
+	}
+	if t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != errorType {
+		return fmt.Errorf("cannot unmarshal function into %s: results must be a value, an error or both", t)
+	}
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+	v.Set(reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.New(t.Out(i)).Elem()
+		}
+		fail := func(err error) []reflect.Value {
+			if !returnsError {
+				panic(err)
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		arguments := make([]value.Value, len(in))
+		for i, argument := range in {
+			val, err := r.marshal(argument)
+			if err != nil {
+				return fail(fmt.Errorf("golox: argument %d: %w", i+1, err))
+			}
+			arguments[i] = val
+		}
+
+		result, hadErrors := r.interpreter.Call(context.Background(), callable, arguments)
+		if hadErrors {
+			return fail(r.fail(true))
+		}
+		if t.NumOut() == 2 || t.NumOut() == 1 && !returnsError {
+			if err := r.unmarshal(result, out[0]); err != nil {
+				return fail(fmt.Errorf("golox: result: %w", err))
+			}
+		}
+		return out
+	}))
+	return nil
+}
+
+// natural converts a Lox value to the Go value it unmarshals to in an
+// empty interface. depth is how deeply val is nested.
+func natural(val value.Value, depth int) (any, error) {
+	switch val.Kind() {
+	case value.KindNil:
+		return nil, nil
+	case value.KindBool:
+		return val.AsBool(), nil
+	case value.KindNumber:
+		return val.AsNumber(), nil
+	case value.KindString:
+		return val.AsString(), nil
+	}
+
+	if depth >= maxDepth {
+		return nil, errTooDeep
+	}
+	depth++
+
+	switch v := val.AsObject().(type) {
+	case *parser.LoxList:
+		elements := make([]any, len(v.Elements))
+		for i, element := range v.Elements {
+			n, err := natural(element, depth)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = n
+		}
+		return elements, nil
+	case *parser.LoxMap:
+		entries := make(map[any]any, len(v.Entries))
+		for key, element := range v.Entries {
+			k, err := natural(key, depth)
+			if err != nil {
+				return nil, err
+			}
+			// lists, maps and instances become unhashable Go values
+			if !reflect.ValueOf(k).Comparable() {
+				return nil, fmt.Errorf("cannot use %s key as a key of map[any]any", typeName(key))
+			}
+			e, err := natural(element, depth)
+			if err != nil {
+				return nil, err
+			}
+			entries[k] = e
+		}
+		return entries, nil
+	case *parser.LoxInstance:
+		fields := make(map[string]any, len(v.Fields()))
+		for name, field := range v.Fields() {
+			f, err := natural(field, depth)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = f
+		}
+		return fields, nil
+	}
+	return val.AsObject(), nil
+}
+
+// mapEntries returns the entries of a map or the fields of an instance
+func mapEntries(val value.Value) (map[value.Value]value.Value, bool) {
+	if !val.IsObject() {
+		return nil, false
+	}
+	switch v := val.AsObject().(type) {
+	case *parser.LoxMap:
+		return v.Entries, true
+	case *parser.LoxInstance:
+		entries := make(map[value.Value]value.Value, len(v.Fields()))
+		for name, field := range v.Fields() {
+			entries[value.String(name)] = field
+		}
+		return entries, true
+	}
+	return nil, false
+}
+
+func typeName(val value.Value) string {
+	if !val.IsObject() {
+		return val.Kind().String()
+	}
+	switch val.AsObject().(type) {
+	case *parser.LoxList:
+		return "list"
+	case *parser.LoxMap:
+		return "map"
+	case *parser.LoxInstance:
+		return "instance"
+	case parser.LoxCallable:
+		return "function"
+	}
+	return fmt.Sprintf("%T", val.AsObject())
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields lists the exported fields of t under their Lox names
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("lox"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
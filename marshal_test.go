@@ -0,0 +1,374 @@
+package golox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/value"
+)
+
+type Base struct {
+	ID int
+}
+
+type Config struct {
+	Base
+	Name    string   `lox:"name"`
+	Limit   uint8    `lox:"limit"`
+	Tags    []string `lox:"tags"`
+	Secret  string   `lox:"-"`
+	private int
+}
+
+func newRuntime(out io.Writer) *Runtime {
+	return New(Options{Stdout: out, Stderr: io.Discard})
+}
+
+// roundTrip marshals v and unmarshals the result into a new value of the
+// same type
+func roundTrip(t *testing.T, v any) any {
+	t.Helper()
+	r := newRuntime(io.Discard)
+	val, err := r.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal(%#v): %v", v, err)
+	}
+	target := reflect.New(reflect.TypeOf(v))
+	if err := r.Unmarshal(val, target.Interface()); err != nil {
+		t.Fatalf("Unmarshal(%s) into %T: %v", val, v, err)
+	}
+	return target.Elem().Interface()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []any{
+		true,
+		"text",
+		3.5,
+		float32(0.25),
+		-42,
+		int8(-128),
+		uint16(65535),
+		[]int{1, 2, 3},
+		[2]string{"a", "b"},
+		map[string]float64{"one": 1, "two": 2},
+		map[float64][]bool{1: {true}, 2: {false, true}},
+		Config{Base: Base{ID: 7}, Name: "orders", Limit: 10, Tags: []string{"x"}},
+		&Config{Name: "pointer"},
+		[]Base{{1}, {2}},
+	}
+	for _, v := range tests {
+		t.Run(fmt.Sprintf("%T", v), func(t *testing.T) {
+			if got := roundTrip(t, v); !reflect.DeepEqual(got, v) {
+				t.Errorf("got %#v, want %#v", got, v)
+			}
+		})
+	}
+}
+
+func TestMarshalStructFields(t *testing.T) {
+	var out bytes.Buffer
+	r := newRuntime(&out)
+	config := Config{Base: Base{ID: 7}, Name: "orders", Limit: 10, Secret: "hidden", private: 1}
+	if err := r.SetGlobal("config", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// embedded fields are promoted and tags rename fields
+	if _, err := r.Eval(context.Background(), "print config.ID; print config.name; print config.limit;"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "7\norders\n10\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	// fields tagged "-" and unexported fields are left out
+	for _, field := range []string{"Secret", "private", "Name", "Base"} {
+		_, err := r.Eval(context.Background(), "config."+field+";")
+		if code := errorCode(t, err); code != errors.UndefinedProperty {
+			t.Errorf("config.%s failed with %q, want %q", field, code, errors.UndefinedProperty)
+		}
+	}
+
+	if got := roundTrip(t, config).(Config); got.Secret != "" || got.private != 0 {
+		t.Errorf("round trip kept left out fields: %#v", got)
+	}
+}
+
+func TestMarshalFunc(t *testing.T) {
+	var out bytes.Buffer
+	r := newRuntime(&out)
+	if err := r.SetGlobal("add", func(a, b float64) float64 { return a + b }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetGlobal("check", func(n int) (string, error) {
+		if n < 0 {
+			return "", fmt.Errorf("negative: %d", n)
+		}
+		return "ok", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Eval(context.Background(), "print add(1, 2); print check(1);"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "3\nok\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		source  string
+		code    errors.Code
+		message string
+	}{
+		{"add(1);", errors.ArityMismatch, "Expected 2 arguments but got 1."},
+		{"check(-1);", errors.NativeError, "negative: -1"},
+		{`check("a");`, errors.NativeError, "cannot unmarshal string into int"},
+		{"check(1.5);", errors.NativeError, "cannot unmarshal 1.5 into int"},
+	}
+	for _, test := range tests {
+		_, err := r.Eval(context.Background(), test.source)
+		if code := errorCode(t, err); code != test.code {
+			t.Errorf("%s failed with %q, want %q", test.source, code, test.code)
+			continue
+		}
+		if message := err.(*Error).Diagnostics[0].Message; !strings.Contains(message, test.message) {
+			t.Errorf("%s failed with %q, want it to mention %q", test.source, message, test.message)
+		}
+	}
+
+	for _, f := range []any{
+		func(...int) {},
+		func() (int, int) { return 0, 0 },
+		func() (error, int) { return nil, 0 },
+	} {
+		if _, err := r.Marshal(f); err == nil {
+			t.Errorf("Marshal(%T) succeeded", f)
+		}
+	}
+}
+
+func TestSetGlobalNames(t *testing.T) {
+	r := newRuntime(io.Discard)
+	if err := r.SetGlobal("add", func(a, b float64) float64 { return a + b }); err != nil {
+		t.Fatal(err)
+	}
+	// an existing native given a second name keeps its own
+	clock, _ := r.GetGlobal("clock")
+	if err := r.SetGlobal("now", clock); err != nil {
+		t.Fatal(err)
+	}
+
+	for global, want := range map[string]string{"add": "add", "now": "clock", "clock": "clock"} {
+		val, _ := r.GetGlobal(global)
+		if native, _ := value.As[*parser.NativeFunction](val); native.Name != want {
+			t.Errorf("%s is named %q, want %q", global, native.Name, want)
+		}
+	}
+}
+
+func TestUnmarshalFunc(t *testing.T) {
+	r := newRuntime(io.Discard)
+	if _, err := r.Eval(context.Background(), `
+		fun double(n) { return n * 2; }
+		fun fail(n) { return n + "a"; }
+	`); err != nil {
+		t.Fatal(err)
+	}
+	double, _ := r.GetGlobal("double")
+	fail, _ := r.GetGlobal("fail")
+
+	var f func(int) (int, error)
+	if err := r.Unmarshal(double, &f); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f(21); n != 42 || err != nil {
+		t.Errorf("double(21) = %d, %v, want 42", n, err)
+	}
+
+	var wrongArity func(int, int) int
+	if err := r.Unmarshal(double, &wrongArity); err == nil {
+		t.Error("unmarshaling a function of arity 1 into func(int, int) int succeeded")
+	}
+
+	if err := r.Unmarshal(fail, &f); err != nil {
+		t.Fatal(err)
+	}
+	_, err := f(1)
+	if code := errorCode(t, err); code != errors.OperandType {
+		t.Errorf("fail(1) returned %q, want %q", code, errors.OperandType)
+	}
+
+	var noError func(int) int
+	if err := r.Unmarshal(fail, &noError); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("a runtime error in a func without an error result did not panic")
+		}
+	}()
+	noError(1)
+}
+
+type node struct {
+	Next *node
+}
+
+func TestMarshalCycle(t *testing.T) {
+	n := &node{}
+	n.Next = n
+	m := map[string]any{}
+	m["self"] = m
+	s := []any{nil}
+	s[0] = s
+
+	r := newRuntime(io.Discard)
+	for _, v := range []any{n, m, s} {
+		if _, err := r.Marshal(v); err == nil || !strings.Contains(err.Error(), "cyclic") {
+			t.Errorf("Marshal(%T) returned %v, want a cycle error", v, err)
+		}
+	}
+
+	// values reached twice without a cycle are fine
+	shared := &node{}
+	if _, err := r.Marshal([]*node{shared, shared}); err != nil {
+		t.Errorf("Marshal of a shared pointer: %v", err)
+	}
+}
+
+func TestUnmarshalCycle(t *testing.T) {
+	list := parser.NewLoxList(nil)
+	list.Elements = append(list.Elements, value.Obj(list))
+
+	r := newRuntime(io.Discard)
+	var natural any
+	if err := r.Unmarshal(value.Obj(list), &natural); err == nil {
+		t.Error("unmarshaling a cyclic list into any succeeded")
+	}
+	var nested []any
+	if err := r.Unmarshal(value.Obj(list), &nested); err == nil {
+		t.Error("unmarshaling a cyclic list into []any succeeded")
+	}
+}
+
+func TestUnmarshalUnhashableKey(t *testing.T) {
+	key := value.Obj(parser.NewLoxList([]value.Value{value.Number(1)}))
+	m := value.Obj(parser.NewLoxMap(map[value.Value]value.Value{key: value.True}))
+
+	r := newRuntime(io.Discard)
+	var natural any
+	if err := r.Unmarshal(m, &natural); err == nil {
+		t.Error("unmarshaling a map with a list key into any succeeded")
+	}
+	var typed map[any]bool
+	if err := r.Unmarshal(m, &typed); err == nil {
+		t.Error("unmarshaling a map with a list key into map[any]bool succeeded")
+	}
+}
+
+func TestUnmarshalIntegerRange(t *testing.T) {
+	tests := []struct {
+		n      float64
+		target any
+		ok     bool
+	}{
+		{127, new(int8), true},
+		{-128, new(int8), true},
+		{128, new(int8), false},
+		{-129, new(int8), false},
+		{255, new(uint8), true},
+		{256, new(uint8), false},
+		{-1, new(uint), false},
+		{1.5, new(int), false},
+		{1 << 62, new(int64), true},
+		{1 << 63, new(int64), false},
+		{-1 << 63, new(int64), true},
+		{1e19, new(int64), false},
+		{1 << 63, new(uint64), true},
+		{1 << 64, new(uint64), false},
+		{1e30, new(uint64), false},
+	}
+	r := newRuntime(io.Discard)
+	for _, test := range tests {
+		err := r.Unmarshal(value.Number(test.n), test.target)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("Unmarshal(%g) into %T returned %v", test.n, test.target, err)
+		}
+	}
+}
+
+func TestMarshaledCollections(t *testing.T) {
+	var out bytes.Buffer
+	r := newRuntime(&out)
+	if err := r.SetGlobal("list", []any{1, "two"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetGlobal("map", map[string]int{"b": 2, "a": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	source := `
+		list.append(3);
+		list.set(0, "one");
+		print list;
+		print list.get(2) + list.length();
+		map.set("c", 3);
+		print map.has("c");
+		print map.get("missing");
+		print map.keys();
+		print map;
+		list.append(list);
+		map.set("self", map);
+		print list;
+		print map;
+	`
+	if _, err := r.Eval(context.Background(), source); err != nil {
+		t.Fatal(err)
+	}
+	want := `[one, two, 3]
+6
+true
+nil
+[a, b, c]
+{a: 1, b: 2, c: 3}
+[one, two, 3, [...]]
+{a: 1, b: 2, c: 3, self: {...}}
+`
+	if got := out.String(); got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	for _, source := range []string{
+		"list.get(10);",
+		"list.get(0.5);",
+		"list.get(-1);",
+		// larger than any int, so it must not be converted before the bounds check
+		"list.get(1000000000000000000000000000000);",
+		"list.set(\"0\", 1);",
+		"map.set(nil, 1);",
+	} {
+		_, err := r.Eval(context.Background(), source)
+		if code := errorCode(t, err); code != errors.NativeError {
+			t.Errorf("%s failed with %q, want %q", source, code, errors.NativeError)
+		}
+	}
+}
+
+// errorCode returns the code of the first diagnostic of a runtime error
+func errorCode(t *testing.T, err error) errors.Code {
+	t.Helper()
+	e, ok := err.(*Error)
+	if !ok || !e.Runtime {
+		t.Fatalf("got %v, want a runtime error", err)
+	}
+	return e.Diagnostics[0].Code
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AstPrinter renders statements as an indented tree with expressions
+// written in prefix notation, e.g. (+ 1 (* 2 3)).
+type AstPrinter struct {
+	builder strings.Builder
+	depth   int
+}
+
+func NewAstPrinter() *AstPrinter {
+	return &AstPrinter{}
+}
+
+func (a *AstPrinter) Print(statements []Stmt) string {
+	a.builder.Reset()
+	a.depth = 0
+	for _, stmt := range statements {
+		stmt.Accept(a)
+	}
+	return a.builder.String()
+}
+
+func (a *AstPrinter) VisitBlockStmt(stmt *BlockStmt) {
+	a.line("(block")
+	a.nested(stmt.Statements...)
+}
+
+func (a *AstPrinter) VisitClassStmt(stmt *ClassStmt) {
+	header := "(class " + stmt.Name.Lexeme
+	if stmt.Superclass != nil {
+		header += " < " + stmt.Superclass.Name.Lexeme
+	}
+	a.line(header)
+
+	methods := make([]Stmt, len(stmt.Methods))
+	for i, method := range stmt.Methods {
+		methods[i] = method
+	}
+	a.nested(methods...)
+}
+
+func (a *AstPrinter) VisitExpressionStmt(stmt *ExpressionStmt) {
+	a.line("(; " + a.expr(stmt.Expression) + ")")
+}
+
+func (a *AstPrinter) VisitFunctionStmt(stmt *FunctionStmt) {
+	params := make([]string, len(stmt.Params))
+	for i, param := range stmt.Params {
+		params[i] = param.Lexeme
+	}
+	a.line("(fun " + stmt.Name.Lexeme + " (" + strings.Join(params, " ") + ")")
+	a.nested(stmt.Body...)
+}
+
+func (a *AstPrinter) VisitIfStmt(stmt *IfStmt) {
+	a.line("(if " + a.expr(stmt.Condition))
+	if stmt.ElseBranch == nil {
+		a.nested(stmt.ThenBranch)
+		return
+	}
+	a.depth++
+	stmt.ThenBranch.Accept(a)
+	a.depth--
+	a.line("else")
+	a.nested(stmt.ElseBranch)
+}
+
+func (a *AstPrinter) VisitPrintStmt(stmt *PrintStmt) {
+	a.line("(print " + a.expr(stmt.Expression) + ")")
+}
+
+func (a *AstPrinter) VisitReturnStmt(stmt *ReturnStmt) {
+	if stmt.Value == nil {
+		a.line("(return)")
+	} else {
+		a.line("(return " + a.expr(stmt.Value) + ")")
+	}
+}
+
+func (a *AstPrinter) VisitVarStmt(stmt *VarStmt) {
+	if stmt.Initializer == nil {
+		a.line("(var " + stmt.Name.Lexeme + ")")
+	} else {
+		a.line("(var " + stmt.Name.Lexeme + " " + a.expr(stmt.Initializer) + ")")
+	}
+}
+
+func (a *AstPrinter) VisitWhileStmt(stmt *WhileStmt) {
+	a.line("(while " + a.expr(stmt.Condition))
+	a.nested(stmt.Body)
+}
+
+func (a *AstPrinter) VisitAssignExpr(expr *AssignExpr) string {
+	return a.parenthesize("= "+expr.Name.Lexeme, expr.Value)
+}
+
+func (a *AstPrinter) VisitBinaryExpr(expr *BinaryExpr) string {
+	return a.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (a *AstPrinter) VisitCallExpr(expr *CallExpr) string {
+	return a.parenthesize("call", append([]Expr{expr.Callee}, expr.Arguments...)...)
+}
+
+func (a *AstPrinter) VisitGetExpr(expr *GetExpr) string {
+	return "(. " + a.expr(expr.Object) + " " + expr.Name.Lexeme + ")"
+}
+
+func (a *AstPrinter) VisitGroupingExpr(expr *GroupingExpr) string {
+	return a.parenthesize("group", expr.Expression)
+}
+
+func (a *AstPrinter) VisitLiteralExpr(expr *LiteralExpr) string {
+	if expr.Value.IsString() {
+		return fmt.Sprintf("%q", expr.Value.AsString())
+	}
+	return expr.Value.String()
+}
+
+func (a *AstPrinter) VisitLogicalExpr(expr *LogicalExpr) string {
+	return a.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+
+func (a *AstPrinter) VisitSetExpr(expr *SetExpr) string {
+	return "(= (. " + a.expr(expr.Object) + " " + expr.Name.Lexeme + ") " + a.expr(expr.Value) + ")"
+}
+
+func (a *AstPrinter) VisitSuperExpr(expr *SuperExpr) string {
+	return "(super " + expr.Method.Lexeme + ")"
+}
+
+func (a *AstPrinter) VisitThisExpr(expr *ThisExpr) string {
+	return "this"
+}
+
+func (a *AstPrinter) VisitUnaryExpr(expr *UnaryExpr) string {
+	return a.parenthesize(expr.Operator.Lexeme, expr.Right)
+}
+
+func (a *AstPrinter) VisitVariableExpr(expr *VariableExpr) string {
+	return expr.Name.Lexeme
+}
+
+func (a *AstPrinter) expr(expr Expr) string {
+	return Accept[string](expr, a)
+}
+
+func (a *AstPrinter) parenthesize(name string, exprs ...Expr) string {
+	parts := []string{name}
+	for _, expr := range exprs {
+		parts = append(parts, a.expr(expr))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// nested prints statements one level deeper and closes the open line's paren
+func (a *AstPrinter) nested(statements ...Stmt) {
+	a.depth++
+	for _, stmt := range statements {
+		stmt.Accept(a)
+	}
+	a.depth--
+	a.line(")")
+}
+
+func (a *AstPrinter) line(text string) {
+	a.builder.WriteString(strings.Repeat("  ", a.depth))
+	a.builder.WriteString(text)
+	a.builder.WriteString("\n")
+}
@@ -0,0 +1,70 @@
+package parser
+
+import "github.com/maffkipp/golox/value"
+
+type LoxCallable interface {
+	Arity() int
+	Call(interpreter *Interpreter, arguments []value.Value) value.Value
+}
+
+type LoxFunction struct {
+	declaration   *FunctionStmt
+	closure       *Environment
+	isInitializer bool
+}
+
+func NewLoxFunction(declaration *FunctionStmt, closure *Environment, isInitializer bool) *LoxFunction {
+	return &LoxFunction{declaration: declaration, closure: closure, isInitializer: isInitializer}
+}
+
+// Bind returns a copy of the method whose closure defines "this" as instance
+func (f *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+	environment := NewEnclosedEnvironment(f.closure)
+	environment.Define("this", value.Obj(instance))
+	return NewLoxFunction(f.declaration, environment, f.isInitializer)
+}
+
+func (f *LoxFunction) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *LoxFunction) Call(interpreter *Interpreter, arguments []value.Value) (result value.Value) {
+	interpreter.allocate(interpreter.callSite(), environmentSize+len(arguments)*valueSize)
+	environment := NewEnclosedEnvironment(f.closure)
+	for i, param := range f.declaration.Params {
+		environment.Define(param.Lexeme, arguments[i])
+	}
+
+	// A return statement unwinds back here carrying its value
+	defer func() {
+		if r := recover(); r != nil {
+			if ret, ok := r.(*Return); !ok {
+				panic(r)
+			} else if f.isInitializer {
+				result = f.closure.GetAt(0, "this")
+			} else {
+				result = ret.Value
+			}
+		}
+	}()
+
+	interpreter.executeBlock(f.declaration.Body, environment)
+
+	// Initializers always return the instance, even when called directly
+	if f.isInitializer {
+		return f.closure.GetAt(0, "this")
+	}
+	return value.Nil
+}
+
+func (f *LoxFunction) String() string {
+	return "<fn " + f.declaration.Name.Lexeme + ">"
+}
+
+type Return struct {
+	Value value.Value
+}
+
+func NewReturn(val value.Value) *Return {
+	return &Return{Value: val}
+}
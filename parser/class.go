@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/value"
+)
+
+type LoxClass struct {
+	Name       string
+	superclass *LoxClass
+	methods    map[string]*LoxFunction
+}
+
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
+	return &LoxClass{Name: name, superclass: superclass, methods: methods}
+}
+
+// FindMethod walks up the superclass chain until a method is found
+func (c *LoxClass) FindMethod(name string) *LoxFunction {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	}
+	return nil
+}
+
+func (c *LoxClass) Arity() int {
+	if initializer := c.FindMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *LoxClass) Call(interpreter *Interpreter, arguments []value.Value) value.Value {
+	interpreter.allocate(interpreter.callSite(), instanceSize)
+	instance := NewLoxInstance(c)
+	if initializer := c.FindMethod("init"); initializer != nil {
+		interpreter.allocate(interpreter.callSite(), boundMethodSize)
+		initializer.Bind(instance).Call(interpreter, arguments)
+	}
+	return value.Obj(instance)
+}
+
+func (c *LoxClass) String() string {
+	return c.Name
+}
+
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]value.Value
+}
+
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{class: class, fields: make(map[string]value.Value)}
+}
+
+func (i *LoxInstance) Class() *LoxClass {
+	return i.class
+}
+
+// Fields returns the instance's fields by name. Changes to the map are
+// visible to scripts.
+func (i *LoxInstance) Fields() map[string]value.Value {
+	return i.fields
+}
+
+// Fields shadow methods of the same name
+func (i *LoxInstance) Get(name lexer.Token) (value.Value, error) {
+	if val, ok := i.fields[name.Lexeme]; ok {
+		return val, nil
+	}
+
+	if method := i.class.FindMethod(name.Lexeme); method != nil {
+		return value.Obj(method.Bind(i)), nil
+	}
+
+	return value.Nil, NewRuntimeError(name, errors.UndefinedProperty, "Undefined property '"+name.Lexeme+"'.")
+}
+
+func (i *LoxInstance) Set(name lexer.Token, val value.Value) {
+	i.fields[name.Lexeme] = val
+}
+
+func (i *LoxInstance) String() string {
+	return i.class.Name + " instance"
+}
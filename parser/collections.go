@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/value"
+)
+
+// LoxList is an ordered sequence of values. Scripts use it through the
+// methods get, set, append and length.
+type LoxList struct {
+	Elements []value.Value
+}
+
+func NewLoxList(elements []value.Value) *LoxList {
+	return &LoxList{Elements: elements}
+}
+
+func (l *LoxList) Get(name lexer.Token) (value.Value, error) {
+	switch name.Lexeme {
+	case "length":
+		return value.Obj(NewNativeFunction("length", 0, func(arguments []value.Value) (value.Value, error) {
+			return value.Number(float64(len(l.Elements))), nil
+		})), nil
+	case "get":
+		return value.Obj(NewNativeFunction("get", 1, func(arguments []value.Value) (value.Value, error) {
+			index, err := l.index(arguments[0])
+			if err != nil {
+				return value.Nil, err
+			}
+			return l.Elements[index], nil
+		})), nil
+	case "set":
+		return value.Obj(NewNativeFunction("set", 2, func(arguments []value.Value) (value.Value, error) {
+			index, err := l.index(arguments[0])
+			if err != nil {
+				return value.Nil, err
+			}
+			l.Elements[index] = arguments[1]
+			return arguments[1], nil
+		})), nil
+	case "append":
+		return value.Obj(newNative("append", 1, func(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+			interpreter.allocate(interpreter.callSite(), valueSize)
+			l.Elements = append(l.Elements, arguments[0])
+			return value.Nil, nil
+		})), nil
+	}
+	return value.Nil, NewRuntimeError(name, errors.UndefinedProperty, "Undefined property '"+name.Lexeme+"'.")
+}
+
+func (l *LoxList) index(val value.Value) (int, error) {
+	if !val.IsNumber() || val.AsNumber() != math.Trunc(val.AsNumber()) {
+		return 0, fmt.Errorf("index must be an integer, got %s", val)
+	}
+	// compared as floats, since converting large numbers to int wraps
+	n := val.AsNumber()
+	if n < 0 || n >= float64(len(l.Elements)) {
+		return 0, fmt.Errorf("index %s out of range for length %d", val, len(l.Elements))
+	}
+	return int(n), nil
+}
+
+func (l *LoxList) String() string {
+	return l.format(map[any]bool{})
+}
+
+// format prints the list, showing lists and maps that are already being
+// printed further out as [...] and {...} so that cycles terminate
+func (l *LoxList) format(seen map[any]bool) string {
+	if seen[l] {
+		return "[...]"
+	}
+	seen[l] = true
+	defer delete(seen, l)
+
+	elements := make([]string, len(l.Elements))
+	for i, element := range l.Elements {
+		elements[i] = format(element, seen)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// LoxMap associates values with keys, which may be any value other than
+// nil. Scripts use it through the methods get, set, has, keys and length.
+type LoxMap struct {
+	Entries map[value.Value]value.Value
+}
+
+func NewLoxMap(entries map[value.Value]value.Value) *LoxMap {
+	return &LoxMap{Entries: entries}
+}
+
+func (m *LoxMap) Get(name lexer.Token) (value.Value, error) {
+	switch name.Lexeme {
+	case "length":
+		return value.Obj(NewNativeFunction("length", 0, func(arguments []value.Value) (value.Value, error) {
+			return value.Number(float64(len(m.Entries))), nil
+		})), nil
+	case "get":
+		// missing keys read as nil
+		return value.Obj(NewNativeFunction("get", 1, func(arguments []value.Value) (value.Value, error) {
+			return m.Entries[arguments[0]], nil
+		})), nil
+	case "set":
+		return value.Obj(newNative("set", 2, func(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+			if arguments[0].IsNil() {
+				return value.Nil, fmt.Errorf("map keys cannot be nil")
+			}
+			if _, ok := m.Entries[arguments[0]]; !ok {
+				interpreter.allocate(interpreter.callSite(), 2*valueSize)
+			}
+			m.Entries[arguments[0]] = arguments[1]
+			return arguments[1], nil
+		})), nil
+	case "has":
+		return value.Obj(NewNativeFunction("has", 1, func(arguments []value.Value) (value.Value, error) {
+			_, ok := m.Entries[arguments[0]]
+			return value.Bool(ok), nil
+		})), nil
+	case "keys":
+		return value.Obj(newNative("keys", 0, func(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+			interpreter.allocate(interpreter.callSite(), len(m.Entries)*valueSize)
+			return value.Obj(NewLoxList(m.Keys())), nil
+		})), nil
+	}
+	return value.Nil, NewRuntimeError(name, errors.UndefinedProperty, "Undefined property '"+name.Lexeme+"'.")
+}
+
+// Keys returns the keys of the map ordered by their printed form
+func (m *LoxMap) Keys() []value.Value {
+	keys, _ := m.keys(map[any]bool{})
+	return keys
+}
+
+// keys returns the sorted keys along with their printed forms
+func (m *LoxMap) keys(seen map[any]bool) ([]value.Value, []string) {
+	keys := make([]value.Value, 0, len(m.Entries))
+	for key := range m.Entries {
+		keys = append(keys, key)
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = format(key, seen)
+	}
+	sort.Sort(byName{keys, names})
+	return keys, names
+}
+
+type byName struct {
+	keys  []value.Value
+	names []string
+}
+
+func (b byName) Len() int           { return len(b.keys) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+}
+
+func (m *LoxMap) String() string {
+	return m.format(map[any]bool{})
+}
+
+func (m *LoxMap) format(seen map[any]bool) string {
+	if seen[m] {
+		return "{...}"
+	}
+	seen[m] = true
+	defer delete(seen, m)
+
+	keys, names := m.keys(seen)
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = names[i] + ": " + format(m.Entries[key], seen)
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// format prints val, passing on the collections being printed
+func format(val value.Value, seen map[any]bool) string {
+	if val.IsObject() {
+		switch o := val.AsObject().(type) {
+		case *LoxList:
+			return o.format(seen)
+		case *LoxMap:
+			return o.format(seen)
+		}
+	}
+	return val.String()
+}
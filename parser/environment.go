@@ -1,31 +1,84 @@
 package parser
 
-import "github.com/maffkipp/golox/lexer"
+import (
+	"sort"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/value"
+)
 
 type Environment struct {
-	values map[string]any
+	enclosing *Environment
+	values    map[string]value.Value
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{values: make(map[string]any)}
+	return &Environment{values: make(map[string]value.Value)}
+}
+
+func NewEnclosedEnvironment(enclosing *Environment) *Environment {
+	return &Environment{enclosing: enclosing, values: make(map[string]value.Value)}
+}
+
+func (e *Environment) Define(name string, val value.Value) {
+	e.values[name] = val
 }
 
-func (e *Environment) Define(name string, value any) {
-	e.values[name] = value
+// Names returns the variables defined directly in this scope in sorted order
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup finds a variable by name in this scope or any enclosing one
+func (e *Environment) Lookup(name string) (value.Value, bool) {
+	if val, ok := e.values[name]; ok {
+		return val, true
+	}
+	if e.enclosing != nil {
+		return e.enclosing.Lookup(name)
+	}
+	return value.Nil, false
 }
 
-func (e *Environment) Get(name lexer.Token) (any, error) {
+func (e *Environment) Get(name lexer.Token) (value.Value, error) {
 	if val, ok := e.values[name.Lexeme]; ok {
 		return val, nil
 	}
-	return nil, NewRuntimeError(name, "undefined variable '"+name.Lexeme+"'.")
+	if e.enclosing != nil {
+		return e.enclosing.Get(name)
+	}
+	return value.Nil, NewRuntimeError(name, errors.UndefinedVariable, "undefined variable '"+name.Lexeme+"'.")
 }
 
-func (e *Environment) Assign(name lexer.Token, value any) error {
+func (e *Environment) Assign(name lexer.Token, val value.Value) error {
 	if _, ok := e.values[name.Lexeme]; ok {
-		e.Define(name.Lexeme, value)
+		e.values[name.Lexeme] = val
 		return nil
-	} else {
-		return NewRuntimeError(name, "undefined variable '"+name.Lexeme+"'.")
 	}
+	if e.enclosing != nil {
+		return e.enclosing.Assign(name, val)
+	}
+	return NewRuntimeError(name, errors.UndefinedVariable, "undefined variable '"+name.Lexeme+"'.")
+}
+
+func (e *Environment) GetAt(distance int, name string) value.Value {
+	return e.ancestor(distance).values[name]
+}
+
+func (e *Environment) AssignAt(distance int, name lexer.Token, val value.Value) {
+	e.ancestor(distance).values[name.Lexeme] = val
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	environment := e
+	for i := 0; i < distance; i++ {
+		environment = environment.enclosing
+	}
+	return environment
 }
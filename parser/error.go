@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/maffkipp/golox/errors"
 	"github.com/maffkipp/golox/lexer"
@@ -9,38 +10,64 @@ import (
 
 type ParseError struct {
 	Token   lexer.Token
+	Code    errors.Code
 	Message string
+	// Help optionally suggests a fix
+	Help string
 }
 
+// RuntimeError carries the Lox call stack at the point it was raised,
+// innermost frame first.
 type RuntimeError struct {
 	Token   lexer.Token
+	Code    errors.Code
 	Message string
+	Stack   []errors.Frame
+	// Omitted counts frames left out of the middle of a deep Stack
+	Omitted int
 }
 
-func NewParseError(token lexer.Token, message string) *ParseError {
-	return &ParseError{Token: token, Message: message}
+func NewParseError(token lexer.Token, code errors.Code, message string) *ParseError {
+	return &ParseError{Token: token, Code: code, Message: message}
 }
 
-func NewRuntimeError(token lexer.Token, message string) *ParseError {
-	return &ParseError{Token: token, Message: message}
+func NewRuntimeError(token lexer.Token, code errors.Code, message string) *RuntimeError {
+	return &RuntimeError{Token: token, Code: code, Message: message}
 }
 
-func (p *ParseError) Report() {
-	if p.Token.TokenType == lexer.EOF {
-		errors.Report(p.Token.Line, " at end", p.Message)
-	} else {
-		errors.Report(p.Token.Line, "at '"+p.Token.Lexeme+"'", p.Message)
-	}
+func (p *ParseError) Diagnostic() errors.Diagnostic {
+	return errors.Diagnostic{Code: p.Code, Span: p.Token.Span, Message: p.Message, Help: p.Help}
 }
 
 func (p ParseError) Error() string {
-	return errors.LoxErrorFmt(p.Token.Line, "", p.Message)
+	return errors.LoxErrorFmt(p.Token.Span.Line, p.where(), p.Message)
+}
+
+func (p ParseError) where() string {
+	if p.Token.TokenType == lexer.EOF {
+		return " at end"
+	}
+	return " at '" + p.Token.Lexeme + "'"
 }
 
-func (r RuntimeError) Report() {
-	fmt.Printf("%s/n[line %d]", r.Error(), r.Token.Line)
+func (r *RuntimeError) Diagnostic() errors.Diagnostic {
+	d := errors.Diagnostic{Code: r.Code, Span: r.Token.Span, Message: r.Message, Stack: r.Stack}
+	if r.Omitted > 0 {
+		d.Notes = append(d.Notes, fmt.Sprintf("%d frames omitted from the stack trace", r.Omitted))
+	}
+	return d
 }
 
+// Error formats the message followed by the stack trace, e.g.
+//
+//	undefined variable 'b'.
+//	    at inner (script.lox:2:10)
+//	    at <script> (script.lox:5:6)
 func (r RuntimeError) Error() string {
-	return r.Message
+	var b strings.Builder
+	b.WriteString(r.Message)
+	for _, frame := range r.Stack {
+		b.WriteString("\n    at " + frame.String())
+	}
+	return b.String()
 }
@@ -1,18 +1,62 @@
 package parser
 
-import "github.com/maffkipp/golox/lexer"
+import (
+	"fmt"
 
-type Expr interface {
-	Accept(ExprVisitor) any
-}
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/span"
+	"github.com/maffkipp/golox/value"
+)
 
-type ExprVisitor interface {
-	VisitUnaryExpr(UnaryExpr) any
-	VisitBinaryExpr(BinaryExpr) any
-	VisitGroupingExpr(GroupingExpr) any
-	VisitLiteralExpr(LiteralExpr) any
-	VisitVariableExpr(VariableExpr) any
-	VisitAssignExpr(AssignExpr) any
+type Expr interface {
+	Span() span.Span
+}
+
+// ExprVisitor is a pass over expressions producing an R for each
+type ExprVisitor[R any] interface {
+	VisitUnaryExpr(*UnaryExpr) R
+	VisitBinaryExpr(*BinaryExpr) R
+	VisitGroupingExpr(*GroupingExpr) R
+	VisitLiteralExpr(*LiteralExpr) R
+	VisitVariableExpr(*VariableExpr) R
+	VisitAssignExpr(*AssignExpr) R
+	VisitLogicalExpr(*LogicalExpr) R
+	VisitCallExpr(*CallExpr) R
+	VisitGetExpr(*GetExpr) R
+	VisitSetExpr(*SetExpr) R
+	VisitSuperExpr(*SuperExpr) R
+	VisitThisExpr(*ThisExpr) R
+}
+
+// Accept calls the method of visitor for the type of expr
+func Accept[R any](expr Expr, visitor ExprVisitor[R]) R {
+	switch e := expr.(type) {
+	case *UnaryExpr:
+		return visitor.VisitUnaryExpr(e)
+	case *BinaryExpr:
+		return visitor.VisitBinaryExpr(e)
+	case *GroupingExpr:
+		return visitor.VisitGroupingExpr(e)
+	case *LiteralExpr:
+		return visitor.VisitLiteralExpr(e)
+	case *VariableExpr:
+		return visitor.VisitVariableExpr(e)
+	case *AssignExpr:
+		return visitor.VisitAssignExpr(e)
+	case *LogicalExpr:
+		return visitor.VisitLogicalExpr(e)
+	case *CallExpr:
+		return visitor.VisitCallExpr(e)
+	case *GetExpr:
+		return visitor.VisitGetExpr(e)
+	case *SetExpr:
+		return visitor.VisitSetExpr(e)
+	case *SuperExpr:
+		return visitor.VisitSuperExpr(e)
+	case *ThisExpr:
+		return visitor.VisitThisExpr(e)
+	}
+	panic(fmt.Sprintf("unknown expression %T", expr))
 }
 
 type UnaryExpr struct {
@@ -24,8 +68,8 @@ func NewUnaryExpr(operator lexer.Token, right Expr) *UnaryExpr {
 	return &UnaryExpr{operator, right}
 }
 
-func (u UnaryExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitUnaryExpr(u)
+func (u *UnaryExpr) Span() span.Span {
+	return u.Operator.Span.Join(u.Right.Span())
 }
 
 type BinaryExpr struct {
@@ -38,55 +82,154 @@ func NewBinaryExpr(left Expr, operator lexer.Token, right Expr) *BinaryExpr {
 	return &BinaryExpr{left, operator, right}
 }
 
-func (b BinaryExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitBinaryExpr(b)
+func (b *BinaryExpr) Span() span.Span {
+	return b.Left.Span().Join(b.Right.Span())
 }
 
 type GroupingExpr struct {
+	LeftParen  lexer.Token
 	Expression Expr
+	RightParen lexer.Token
 }
 
-func NewGroupingExpr(expression Expr) *GroupingExpr {
-	return &GroupingExpr{expression}
+func NewGroupingExpr(leftParen lexer.Token, expression Expr, rightParen lexer.Token) *GroupingExpr {
+	return &GroupingExpr{leftParen, expression, rightParen}
 }
 
-func (g GroupingExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitGroupingExpr(g)
+func (g *GroupingExpr) Span() span.Span {
+	return g.LeftParen.Span.Join(g.RightParen.Span)
 }
 
 type LiteralExpr struct {
-	Value any
+	Token lexer.Token
+	Value value.Value
 }
 
-func NewLiteralExpr(value any) *LiteralExpr {
-	return &LiteralExpr{value}
+func NewLiteralExpr(token lexer.Token, val value.Value) *LiteralExpr {
+	return &LiteralExpr{token, val}
 }
 
-func (l LiteralExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitLiteralExpr(l)
+func (l *LiteralExpr) Span() span.Span {
+	return l.Token.Span
 }
 
 type VariableExpr struct {
 	Name lexer.Token
+	local
 }
 
 func NewVariableExpr(name lexer.Token) *VariableExpr {
 	return &VariableExpr{Name: name}
 }
 
-func (v VariableExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitVariableExpr(v)
+func (v *VariableExpr) Span() span.Span {
+	return v.Name.Span
 }
 
 type AssignExpr struct {
 	Name  lexer.Token
 	Value Expr
+	local
 }
 
 func NewAssignExpr(name lexer.Token, value Expr) *AssignExpr {
 	return &AssignExpr{Name: name, Value: value}
 }
 
-func (a AssignExpr) Accept(visitor ExprVisitor) any {
-	return visitor.VisitAssignExpr(a)
+func (a *AssignExpr) Span() span.Span {
+	return a.Name.Span.Join(a.Value.Span())
+}
+
+type LogicalExpr struct {
+	Left     Expr
+	Operator lexer.Token
+	Right    Expr
+}
+
+func NewLogicalExpr(left Expr, operator lexer.Token, right Expr) *LogicalExpr {
+	return &LogicalExpr{left, operator, right}
+}
+
+func (l *LogicalExpr) Span() span.Span {
+	return l.Left.Span().Join(l.Right.Span())
+}
+
+type CallExpr struct {
+	Callee    Expr
+	Paren     lexer.Token
+	Arguments []Expr
+}
+
+func NewCallExpr(callee Expr, paren lexer.Token, arguments []Expr) *CallExpr {
+	return &CallExpr{callee, paren, arguments}
+}
+
+func (c *CallExpr) Span() span.Span {
+	return c.Callee.Span().Join(c.Paren.Span)
+}
+
+type GetExpr struct {
+	Object Expr
+	Name   lexer.Token
+}
+
+func NewGetExpr(object Expr, name lexer.Token) *GetExpr {
+	return &GetExpr{Object: object, Name: name}
+}
+
+func (g *GetExpr) Span() span.Span {
+	return g.Object.Span().Join(g.Name.Span)
+}
+
+type SetExpr struct {
+	Object Expr
+	Name   lexer.Token
+	Value  Expr
+}
+
+func NewSetExpr(object Expr, name lexer.Token, value Expr) *SetExpr {
+	return &SetExpr{Object: object, Name: name, Value: value}
+}
+
+func (s *SetExpr) Span() span.Span {
+	return s.Object.Span().Join(s.Value.Span())
+}
+
+type SuperExpr struct {
+	Keyword lexer.Token
+	Method  lexer.Token
+	local
+}
+
+func NewSuperExpr(keyword lexer.Token, method lexer.Token) *SuperExpr {
+	return &SuperExpr{Keyword: keyword, Method: method}
+}
+
+func (s *SuperExpr) Span() span.Span {
+	return s.Keyword.Span.Join(s.Method.Span)
+}
+
+type ThisExpr struct {
+	Keyword lexer.Token
+	local
+}
+
+func NewThisExpr(keyword lexer.Token) *ThisExpr {
+	return &ThisExpr{Keyword: keyword}
+}
+
+func (t *ThisExpr) Span() span.Span {
+	return t.Keyword.Span
+}
+
+// local is where the resolver found the variable an expression refers
+// to. Expressions left unresolved refer to globals.
+type local struct {
+	distance int
+	resolved bool
+}
+
+func (l *local) resolve(distance int) {
+	l.distance = distance
+	l.resolved = true
 }
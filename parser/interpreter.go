@@ -1,24 +1,121 @@
 package parser
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 
+	"github.com/maffkipp/golox/errors"
 	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/span"
+	"github.com/maffkipp/golox/value"
 )
 
 type Interpreter struct {
+	sink        errors.Sink
+	out         io.Writer
+	globals     *Environment
 	environment *Environment
+	// calls in progress, outermost first
+	frames []callFrame
+	// set while a guarded run is in progress
+	running bool
+	ctx     context.Context
+	limits  Limits
+	steps   int
+	// bytes charged by allocate during the current run
+	allocated int
 }
 
-func NewInterpreter() *Interpreter {
-	return &Interpreter{environment: NewEnvironment()}
+// callFrame records a call in progress for runtime error stack traces
+type callFrame struct {
+	callable LoxCallable
+	// the call expression, or nil for calls made by the host
+	callSite node
 }
 
-func (i *Interpreter) Interpret(statements []Stmt) (hadErrors bool) {
+// propertyGetter is implemented by the values that have properties:
+// instances, lists and maps
+type propertyGetter interface {
+	Get(name lexer.Token) (value.Value, error)
+}
+
+func NewInterpreter(sink errors.Sink) *Interpreter {
+	globals := NewEnvironment()
+	i := &Interpreter{sink: sink, out: os.Stdout, globals: globals, environment: globals, ctx: context.Background(), limits: Limits{MaxCallDepth: DefaultMaxCallDepth}}
+	i.defineNatives()
+	return i
+}
+
+// SetOutput directs the output of print statements to w
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.out = w
+}
+
+func (i *Interpreter) Globals() *Environment {
+	return i.globals
+}
+
+// Interpret runs statements until they finish, fail, exhaust the limits
+// or ctx is done
+func (i *Interpreter) Interpret(ctx context.Context, statements []Stmt) (hadErrors bool) {
+	return i.guard(ctx, func() {
+		for _, stmt := range statements {
+			i.execute(stmt)
+		}
+	})
+}
+
+// Run executes statements as a single run, so the limits apply to them
+// as a whole, and returns the value of the last one when it is an
+// expression statement
+func (i *Interpreter) Run(ctx context.Context, statements []Stmt) (result value.Value, hadErrors bool) {
+	hadErrors = i.guard(ctx, func() {
+		for n, stmt := range statements {
+			if last, ok := stmt.(*ExpressionStmt); ok && n == len(statements)-1 {
+				result = i.evaluate(last.Expression)
+				break
+			}
+			i.execute(stmt)
+		}
+	})
+	return result, hadErrors
+}
+
+// Call invokes callable on behalf of the host program. The caller is
+// responsible for checking the number of arguments against its arity.
+func (i *Interpreter) Call(ctx context.Context, callable LoxCallable, arguments []value.Value) (result value.Value, hadErrors bool) {
+	hadErrors = i.guard(ctx, func() {
+		i.checkCallDepth(nil)
+		i.frames = append(i.frames, callFrame{callable: callable})
+		result = callable.Call(i, arguments)
+		i.frames = i.frames[:len(i.frames)-1]
+	})
+	return result, hadErrors
+}
+
+// guard runs f, reporting a runtime error raised inside it to the sink.
+// When a native function calls back into Lox the run is already guarded,
+// so errors unwind to the outermost guard with the whole stack intact
+// and the outermost context and step budget stay in force.
+func (i *Interpreter) guard(ctx context.Context, f func()) (hadErrors bool) {
+	if i.running {
+		f()
+		return false
+	}
+
+	i.begin(ctx)
+	i.running = true
 	defer func() {
+		i.running = false
 		if err := recover(); err != nil {
-			if pe, ok := err.(ParseError); ok {
-				pe.Report()
+			if re, ok := err.(*RuntimeError); ok {
+				re.Stack, re.Omitted = errors.TrimStack(i.stackTrace(re.Token.Span))
+				i.sink.Report(re.Diagnostic())
+				// leave the interpreter usable for whatever runs next
+				i.environment = i.globals
+				i.frames = nil
 				hadErrors = true
 			} else {
 				panic(err)
@@ -26,9 +123,7 @@ func (i *Interpreter) Interpret(statements []Stmt) (hadErrors bool) {
 		}
 	}()
 
-	for _, stmt := range statements {
-		i.execute(stmt)
-	}
+	f()
 	return hadErrors
 }
 
@@ -36,147 +131,364 @@ func (i *Interpreter) VisitExpressionStmt(stmt *ExpressionStmt) {
 	i.evaluate(stmt.Expression)
 }
 
+func (i *Interpreter) VisitClassStmt(stmt *ClassStmt) {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		class, ok := value.As[*LoxClass](i.evaluate(stmt.Superclass))
+		if !ok {
+			panic(NewRuntimeError(stmt.Superclass.Name, errors.SuperclassNotClass, "Superclass must be a class."))
+		}
+		superclass = class
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, value.Nil)
+
+	// Methods close over an extra scope holding "super"
+	if superclass != nil {
+		i.allocate(stmt, environmentSize+valueSize)
+		i.environment = NewEnclosedEnvironment(i.environment)
+		i.environment.Define("super", value.Obj(superclass))
+	}
+
+	i.allocate(stmt, len(stmt.Methods)*closureSize)
+	methods := make(map[string]*LoxFunction)
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = NewLoxFunction(method, i.environment, method.Name.Lexeme == "init")
+	}
+
+	class := NewLoxClass(stmt.Name.Lexeme, superclass, methods)
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	if err := i.environment.Assign(stmt.Name, value.Obj(class)); err != nil {
+		panic(err)
+	}
+}
+
+func (i *Interpreter) VisitFunctionStmt(stmt *FunctionStmt) {
+	i.allocate(stmt, closureSize+valueSize)
+	function := NewLoxFunction(stmt, i.environment, false)
+	i.environment.Define(stmt.Name.Lexeme, value.Obj(function))
+}
+
+func (i *Interpreter) VisitIfStmt(stmt *IfStmt) {
+	if i.evaluate(stmt.Condition).Truthy() {
+		i.execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		i.execute(stmt.ElseBranch)
+	}
+}
+
 func (i *Interpreter) VisitPrintStmt(stmt *PrintStmt) {
-	value := i.evaluate(stmt.Expression)
-	fmt.Print(stringify(value))
+	fmt.Fprintln(i.out, i.evaluate(stmt.Expression).String())
 }
 
 func (i *Interpreter) VisitBlockStmt(stmt *BlockStmt) {
+	i.allocate(stmt, environmentSize)
+	i.executeBlock(stmt.Statements, NewEnclosedEnvironment(i.environment))
+}
 
+func (i *Interpreter) VisitReturnStmt(stmt *ReturnStmt) {
+	result := value.Nil
+	if stmt.Value != nil {
+		result = i.evaluate(stmt.Value)
+	}
+	panic(NewReturn(result))
 }
 
 func (i *Interpreter) VisitVarStmt(stmt *VarStmt) {
-	var val any
-	// make sure this works!!
+	val := value.Nil
 	if stmt.Initializer != nil {
 		val = i.evaluate(stmt.Initializer)
 	}
+	i.allocate(stmt, valueSize)
 	i.environment.Define(stmt.Name.Lexeme, val)
 }
 
-func (i *Interpreter) VisitLiteralExpr(expr LiteralExpr) any {
+func (i *Interpreter) VisitWhileStmt(stmt *WhileStmt) {
+	for i.evaluate(stmt.Condition).Truthy() {
+		i.execute(stmt.Body)
+	}
+}
+
+func (i *Interpreter) VisitLiteralExpr(expr *LiteralExpr) value.Value {
 	return expr.Value
 }
 
-func (i *Interpreter) VisitGroupingExpr(expr GroupingExpr) any {
+func (i *Interpreter) VisitGroupingExpr(expr *GroupingExpr) value.Value {
 	return i.evaluate(expr.Expression)
 }
 
-func (i *Interpreter) VisitUnaryExpr(expr UnaryExpr) any {
+func (i *Interpreter) VisitUnaryExpr(expr *UnaryExpr) value.Value {
 	right := i.evaluate(expr.Right)
 
 	switch expr.Operator.TokenType {
 	case lexer.BANG:
-		return !isTruthy(right)
+		return value.Bool(!right.Truthy())
 	case lexer.MINUS:
-		return -right.(float64)
+		if !right.IsNumber() {
+			panic(NewRuntimeError(expr.Operator, errors.OperandType, "Operand must be a number."))
+		}
+		return value.Number(-right.AsNumber())
 	}
 
-	return nil
+	return value.Nil
 }
 
-func (i *Interpreter) VisitBinaryExpr(expr BinaryExpr) any {
+func (i *Interpreter) VisitBinaryExpr(expr *BinaryExpr) value.Value {
 	left := i.evaluate(expr.Left)
 	right := i.evaluate(expr.Right)
 
 	switch expr.Operator.TokenType {
 	case lexer.MINUS:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) - right.(float64)
+		return value.Number(left.AsNumber() - right.AsNumber())
 	case lexer.SLASH:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) / right.(float64)
+		return value.Number(left.AsNumber() / right.AsNumber())
 	case lexer.STAR:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) * right.(float64)
+		return value.Number(left.AsNumber() * right.AsNumber())
 	case lexer.PLUS:
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
-				return l + r
-			}
+		if left.IsNumber() && right.IsNumber() {
+			return value.Number(left.AsNumber() + right.AsNumber())
 		}
-		if l, ok := left.(string); ok {
-			if r, ok := right.(string); ok {
-				return l + r
-			}
+		if left.IsString() && right.IsString() {
+			l, r := left.AsString(), right.AsString()
+			i.allocate(expr, len(l)+len(r))
+			return value.String(l + r)
 		}
-		err := NewRuntimeError(expr.Operator, "operands must be numbers.")
+		err := NewRuntimeError(expr.Operator, errors.OperandType, "operands must be numbers.")
 		panic(err)
 	case lexer.GREATER:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) > right.(float64)
+		return value.Bool(left.AsNumber() > right.AsNumber())
 	case lexer.GREATER_EQUAL:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) >= right.(float64)
+		return value.Bool(left.AsNumber() >= right.AsNumber())
 	case lexer.LESS:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) < right.(float64)
+		return value.Bool(left.AsNumber() < right.AsNumber())
 	case lexer.LESS_EQUAL:
 		checkNumberOperands(expr.Operator, left, right)
-		return left.(float64) <= right.(float64)
+		return value.Bool(left.AsNumber() <= right.AsNumber())
 	case lexer.BANG_EQUAL:
-		return !isEqual(left, right)
+		return value.Bool(!value.Equal(left, right))
 	case lexer.EQUAL_EQUAL:
-		return isEqual(left, right)
+		return value.Bool(value.Equal(left, right))
 	}
 
-	return nil
+	return value.Nil
 }
 
-func (i *Interpreter) VisitVariableExpr(expr VariableExpr) any {
-	if val, err := i.environment.Get(expr.Name); err != nil {
-		panic(err)
-	} else {
+// Logical operators short-circuit and return the operand that decided
+// the result rather than a coerced bool.
+func (i *Interpreter) VisitLogicalExpr(expr *LogicalExpr) value.Value {
+	left := i.evaluate(expr.Left)
+
+	if expr.Operator.TokenType == lexer.OR {
+		if left.Truthy() {
+			return left
+		}
+	} else if !left.Truthy() {
+		return left
+	}
+
+	return i.evaluate(expr.Right)
+}
+
+func (i *Interpreter) VisitCallExpr(expr *CallExpr) value.Value {
+	callee := i.evaluate(expr.Callee)
+
+	arguments := make([]value.Value, 0, len(expr.Arguments))
+	for _, argument := range expr.Arguments {
+		arguments = append(arguments, i.evaluate(argument))
+	}
+
+	function, ok := value.As[LoxCallable](callee)
+	if !ok {
+		panic(NewRuntimeError(expr.Paren, errors.NotCallable, "Can only call functions and classes."))
+	}
+
+	if len(arguments) != function.Arity() {
+		panic(NewRuntimeError(expr.Paren, errors.ArityMismatch, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments))))
+	}
+
+	i.checkCallDepth(expr)
+
+	// Frames are only popped on a normal return so that a runtime error
+	// unwinding to Interpret still sees the full stack.
+	i.frames = append(i.frames, callFrame{callable: function, callSite: expr})
+	result := function.Call(i, arguments)
+	i.frames = i.frames[:len(i.frames)-1]
+
+	return result
+}
+
+func (i *Interpreter) VisitGetExpr(expr *GetExpr) value.Value {
+	object := i.evaluate(expr.Object)
+
+	if getter, ok := value.As[propertyGetter](object); ok {
+		val, err := getter.Get(expr.Name)
+		if err != nil {
+			panic(err)
+		}
+		if instance, ok := getter.(*LoxInstance); ok {
+			if _, ok := instance.fields[expr.Name.Lexeme]; ok {
+				return val
+			}
+		}
+		// anything but a field is a method bound to the object
+		i.allocate(expr, boundMethodSize)
 		return val
 	}
+
+	panic(NewRuntimeError(expr.Name, errors.PropertyOnNonInstance, "Only instances have properties."))
+}
+
+func (i *Interpreter) VisitSetExpr(expr *SetExpr) value.Value {
+	object := i.evaluate(expr.Object)
+
+	instance, ok := value.As[*LoxInstance](object)
+	if !ok {
+		panic(NewRuntimeError(expr.Name, errors.FieldOnNonInstance, "Only instances have fields."))
+	}
+
+	val := i.evaluate(expr.Value)
+	if _, ok := instance.fields[expr.Name.Lexeme]; !ok {
+		i.allocate(expr, len(expr.Name.Lexeme)+valueSize)
+	}
+	instance.Set(expr.Name, val)
+	return val
+}
+
+func (i *Interpreter) VisitSuperExpr(expr *SuperExpr) value.Value {
+	distance := expr.distance
+	superclass, _ := value.As[*LoxClass](i.environment.GetAt(distance, "super"))
+
+	// "this" is always bound one scope inside the "super" scope
+	object, _ := value.As[*LoxInstance](i.environment.GetAt(distance-1, "this"))
+
+	method := superclass.FindMethod(expr.Method.Lexeme)
+	if method == nil {
+		panic(NewRuntimeError(expr.Method, errors.UndefinedProperty, "Undefined property '"+expr.Method.Lexeme+"'."))
+	}
+
+	i.allocate(expr, boundMethodSize)
+	return value.Obj(method.Bind(object))
+}
+
+func (i *Interpreter) VisitThisExpr(expr *ThisExpr) value.Value {
+	return i.lookUpVariable(expr.Keyword, expr.local)
+}
+
+func (i *Interpreter) VisitVariableExpr(expr *VariableExpr) value.Value {
+	return i.lookUpVariable(expr.Name, expr.local)
+}
+
+func (i *Interpreter) VisitAssignExpr(expr *AssignExpr) value.Value {
+	val := i.evaluate(expr.Value)
+
+	if expr.resolved {
+		i.environment.AssignAt(expr.distance, expr.Name, val)
+	} else if err := i.globals.Assign(expr.Name, val); err != nil {
+		panic(err)
+	}
+	return val
 }
 
-func (i *Interpreter) VisitAssignExpr(expr AssignExpr) any {
-	value := i.evaluate(expr.Value)
-	i.environment.Assign(expr.Name, value)
-	return value
+// Resolve records that expr refers to a local variable depth scopes out.
+// The distance is kept on the expression itself, so it is freed along
+// with the code once nothing can run it again.
+func (i *Interpreter) Resolve(expr Expr, depth int) {
+	if r, ok := expr.(interface{ resolve(int) }); ok {
+		r.resolve(depth)
+	}
+}
+
+func (i *Interpreter) lookUpVariable(name lexer.Token, at local) value.Value {
+	if at.resolved {
+		return i.environment.GetAt(at.distance, name.Lexeme)
+	}
+
+	if val, err := i.globals.Get(name); err != nil {
+		panic(err)
+	} else {
+		return val
+	}
 }
 
 func (i *Interpreter) execute(stmt Stmt) {
+	i.step(stmt)
 	stmt.Accept(i)
 }
 
-func (i *Interpreter) evaluate(expr Expr) any {
-	return expr.Accept(i)
+// stackTrace lists the active calls innermost first, starting at the
+// position the error was raised.
+func (i *Interpreter) stackTrace(at span.Span) []errors.Frame {
+	stack := []errors.Frame{}
+	for j := len(i.frames) - 1; j >= 0; j-- {
+		frame := errors.Frame{Function: callableName(i.frames[j].callable), Span: at}
+		// native code has no position in the script
+		if _, ok := i.frames[j].callable.(*NativeFunction); ok {
+			frame.Span = span.Span{}
+		}
+		stack = append(stack, frame)
+		at = spanOf(i.frames[j].callSite)
+	}
+
+	// calls made by the host program have no call site in the script
+	if at == (span.Span{}) {
+		return stack
+	}
+	return append(stack, errors.Frame{Function: "<script>", Span: at})
 }
 
-func stringify(val any) string {
-	if val == nil {
-		return "nil"
+// callSite is the innermost call in progress
+func (i *Interpreter) callSite() node {
+	if len(i.frames) == 0 {
+		return nil
 	}
-	return fmt.Sprintf("%v", val)
+	return i.frames[len(i.frames)-1].callSite
 }
 
-func isTruthy(val any) bool {
-	if val == nil {
-		return false
-	} else if v, ok := val.(bool); ok {
-		return v
+func callableName(callable LoxCallable) string {
+	switch c := callable.(type) {
+	case *LoxFunction:
+		return c.declaration.Name.Lexeme
+	case *LoxClass:
+		return c.Name
+	case *NativeFunction:
+		return c.Name
 	}
-	return true
+	return "<native>"
 }
 
-func isEqual(left any, right any) bool {
-	if left == nil && right == nil {
-		return true
-	} else if left == nil {
-		return false
+func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) {
+	previous := i.environment
+	// Restore the outer scope even if a runtime error unwinds through the block
+	defer func() {
+		i.environment = previous
+	}()
+
+	i.environment = environment
+	for _, stmt := range statements {
+		i.execute(stmt)
 	}
-	return left == right
 }
 
-func checkNumberOperands(operator lexer.Token, left any, right any) {
-	if _, ok := left.(float64); ok {
-		if _, ok := right.(float64); ok {
-			return
-		}
+func (i *Interpreter) evaluate(expr Expr) value.Value {
+	i.step(expr)
+	return Accept[value.Value](expr, i)
+}
+
+func checkNumberOperands(operator lexer.Token, left value.Value, right value.Value) {
+	if left.IsNumber() && right.IsNumber() {
+		return
 	}
 
-	err := NewRuntimeError(operator, "operands must be numbers.")
+	err := NewRuntimeError(operator, errors.OperandType, "operands must be numbers.")
 	panic(err)
 }
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/span"
+)
+
+// DefaultMaxCallDepth stops runaway recursion well before it exhausts the
+// Go stack
+const DefaultMaxCallDepth = 10000
+
+// The context is only polled every so many steps to keep it cheap
+const cancelCheckInterval = 1024
+
+// Limits bound the work a single run may do. Zero means unlimited.
+type Limits struct {
+	// MaxSteps is the number of statements and expressions evaluated
+	MaxSteps int
+	// MaxCallDepth is the number of nested calls in progress
+	MaxCallDepth int
+	// MaxAllocation is the number of bytes a run may allocate, counted as
+	// described by golox.Options.MaxAllocation
+	MaxAllocation int
+}
+
+func (i *Interpreter) SetLimits(limits Limits) {
+	i.limits = limits
+}
+
+// node is a piece of syntax. Finding its span walks the tree below it,
+// so spans are only computed once an error needs one.
+type node interface {
+	Span() span.Span
+}
+
+// spanOf returns the span of n, or the zero Span for code run by the host
+func spanOf(n node) span.Span {
+	if n == nil {
+		return span.Span{}
+	}
+	return n.Span()
+}
+
+// step accounts for evaluating at, stopping the run when the budget is
+// spent or the context is done
+func (i *Interpreter) step(at node) {
+	i.steps++
+	if i.limits.MaxSteps > 0 && i.steps > i.limits.MaxSteps {
+		panic(limitError(at, errors.StepLimit, fmt.Sprintf("Step budget of %d exceeded.", i.limits.MaxSteps)))
+	}
+
+	if i.steps%cancelCheckInterval == 0 {
+		if err := i.ctx.Err(); err != nil {
+			panic(limitError(at, errors.Cancelled, "Execution stopped: "+err.Error()+"."))
+		}
+	}
+}
+
+// checkCallDepth is called before each call is pushed
+func (i *Interpreter) checkCallDepth(at node) {
+	if i.limits.MaxCallDepth > 0 && len(i.frames) >= i.limits.MaxCallDepth {
+		panic(limitError(at, errors.StackOverflow, fmt.Sprintf("Stack overflow: more than %d nested calls.", i.limits.MaxCallDepth)))
+	}
+}
+
+func limitError(at node, code errors.Code, message string) *RuntimeError {
+	return NewRuntimeError(lexer.Token{Span: spanOf(at)}, code, message)
+}
+
+// begin prepares for an outermost run under ctx
+func (i *Interpreter) begin(ctx context.Context) {
+	i.ctx = ctx
+	i.steps = 0
+	i.allocated = 0
+}
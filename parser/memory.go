@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/maffkipp/golox/errors"
+)
+
+// Approximate sizes in bytes charged for the values a script creates
+const (
+	// valueSize is charged per slot holding a value: a field, list element
+	// or map entry
+	valueSize = 24
+	// instanceSize is charged for each instance before its fields
+	instanceSize = 48
+	// environmentSize is charged for each scope entered by a block or
+	// call before its variables
+	environmentSize = 48
+	// closureSize is charged for each function, method and bound method
+	closureSize = 32
+	// boundMethodSize covers a method bound to an object, along with the
+	// scope defining "this"
+	boundMethodSize = closureSize + environmentSize + valueSize
+)
+
+// allocate charges bytes to the current run, raising a runtime error at
+// at once the allocation limit is passed. What is charged is described
+// by golox.Options.MaxAllocation.
+func (i *Interpreter) allocate(at node, bytes int) {
+	i.allocated += bytes
+	if i.limits.MaxAllocation > 0 && i.allocated > i.limits.MaxAllocation {
+		i.allocationLimitExceeded(at)
+	}
+}
+
+// allocationLimitExceeded is kept out of allocate so that it can be inlined
+func (i *Interpreter) allocationLimitExceeded(at node) {
+	panic(limitError(at, errors.AllocationLimit, fmt.Sprintf("Allocation limit of %d bytes exceeded.", i.limits.MaxAllocation)))
+}
+
+// AllocatedBytes returns the bytes charged by allocate during the current
+// or last run
+func (i *Interpreter) AllocatedBytes() int {
+	return i.allocated
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/value"
+)
+
+// NativeFunction is a LoxCallable implemented by the host program. An
+// error returned by the Go function becomes a Lox runtime error raised
+// at the call.
+type NativeFunction struct {
+	Name  string
+	arity int
+	fn    func(interpreter *Interpreter, arguments []value.Value) (value.Value, error)
+}
+
+func NewNativeFunction(name string, arity int, fn func(arguments []value.Value) (value.Value, error)) *NativeFunction {
+	return newNative(name, arity, func(interpreter *Interpreter, arguments []value.Value) (value.Value, error) {
+		return fn(arguments)
+	})
+}
+
+// newNative makes a native function that can use the interpreter, such
+// as the methods of lists and maps which account for what they allocate
+func newNative(name string, arity int, fn func(interpreter *Interpreter, arguments []value.Value) (value.Value, error)) *NativeFunction {
+	return &NativeFunction{Name: name, arity: arity, fn: fn}
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Call(interpreter *Interpreter, arguments []value.Value) value.Value {
+	result, err := n.fn(interpreter, arguments)
+	if err != nil {
+		token := lexer.Token{TokenType: lexer.IDENTIFIER, Lexeme: n.Name, Span: spanOf(interpreter.callSite())}
+		panic(NewRuntimeError(token, errors.NativeError, n.Name+": "+err.Error()))
+	}
+	return result
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn>"
+}
+
+// RegisterNative defines a global function implemented in Go
+func (i *Interpreter) RegisterNative(name string, arity int, fn func(arguments []value.Value) (value.Value, error)) {
+	i.globals.Define(name, value.Obj(NewNativeFunction(name, arity, fn)))
+}
+
+// defineNatives installs the functions every Lox program can rely on
+func (i *Interpreter) defineNatives() {
+	i.RegisterNative("clock", 0, func(arguments []value.Value) (value.Value, error) {
+		return value.Number(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+	})
+}
@@ -1,35 +1,54 @@
 package parser
 
 import (
-	"fmt"
-
+	"github.com/maffkipp/golox/errors"
 	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/value"
 )
 
+const maxArguments = 255
+
+// expectCodes classifies a failed consume by the token that was expected
+var expectCodes = map[lexer.TokenType]errors.Code{
+	lexer.SEMICOLON:   errors.ExpectSemicolon,
+	lexer.LEFT_PAREN:  errors.ExpectParen,
+	lexer.RIGHT_PAREN: errors.ExpectParen,
+	lexer.LEFT_BRACE:  errors.ExpectBrace,
+	lexer.RIGHT_BRACE: errors.ExpectBrace,
+	lexer.IDENTIFIER:  errors.ExpectName,
+	lexer.DOT:         errors.ExpectDot,
+}
+
 type Parser struct {
-	tokens  []lexer.Token
-	current int
+	sink      errors.Sink
+	tokens    []lexer.Token
+	current   int
+	hadErrors bool
 }
 
-func NewParser(tokens []lexer.Token) *Parser {
-	return &Parser{tokens, 0}
+func NewParser(tokens []lexer.Token, sink errors.Sink) *Parser {
+	return &Parser{sink: sink, tokens: tokens}
 }
 
+// Parse returns the statements that parsed cleanly; those with errors
+// are reported to the sink and left out.
 func (p *Parser) Parse() (statements []Stmt, hadErrors bool) {
 
 	for !p.isAtEnd() {
-		statements = append(statements, p.declaration())
+		if stmt := p.declaration(); stmt != nil {
+			statements = append(statements, stmt)
+		}
 	}
 
-	return statements, false
+	return statements, p.hadErrors
 }
 
 func (p *Parser) declaration() Stmt {
 	// Error boundary should be at each statement
 	defer func() {
 		if err := recover(); err != nil {
-			if parseErr, ok := err.(ParseError); ok {
-				parseErr.Report()
+			if parseErr, ok := err.(*ParseError); ok {
+				p.error(parseErr)
 				p.synchronize()
 				return
 			} else {
@@ -38,6 +57,12 @@ func (p *Parser) declaration() Stmt {
 		}
 	}()
 
+	if p.match(lexer.CLASS) {
+		return p.classDeclaration()
+	}
+	if p.match(lexer.FUN) {
+		return p.function("function")
+	}
 	if p.match(lexer.VAR) {
 		return p.varDeclaration()
 	}
@@ -45,12 +70,170 @@ func (p *Parser) declaration() Stmt {
 }
 
 func (p *Parser) statement() Stmt {
+	if p.match(lexer.FOR) {
+		return p.forStatement()
+	}
+	if p.match(lexer.IF) {
+		return p.ifStatement()
+	}
 	if p.match(lexer.PRINT) {
 		return p.printStatement()
 	}
+	if p.match(lexer.RETURN) {
+		return p.returnStatement()
+	}
+	if p.match(lexer.WHILE) {
+		return p.whileStatement()
+	}
+	if p.match(lexer.LEFT_BRACE) {
+		leftBrace := p.previous()
+		statements := p.block()
+		return NewBlockStmt(leftBrace, statements, p.previous())
+	}
 	return p.expressionStatement()
 }
 
+// For loops are desugared into a while loop wrapped in blocks
+// holding the initializer and increment. The synthesized nodes span
+// the whole loop.
+func (p *Parser) forStatement() Stmt {
+	keyword := p.previous()
+	p.consume(lexer.LEFT_PAREN, "Expect '(' after 'for'.")
+
+	var initializer Stmt
+	if p.match(lexer.SEMICOLON) {
+		initializer = nil
+	} else if p.match(lexer.VAR) {
+		initializer = p.varDeclaration()
+	} else {
+		initializer = p.expressionStatement()
+	}
+
+	var condition Expr
+	if !p.check(lexer.SEMICOLON) {
+		condition = p.expression()
+	}
+	semicolon := p.consume(lexer.SEMICOLON, "Expect ';' after loop condition.")
+
+	var increment Expr
+	if !p.check(lexer.RIGHT_PAREN) {
+		increment = p.expression()
+	}
+	p.consume(lexer.RIGHT_PAREN, "Expect ')' after for clauses.")
+
+	body := p.statement()
+	end := p.previous()
+
+	if increment != nil {
+		body = NewBlockStmt(keyword, []Stmt{body, NewExpressionStmt(increment)}, end)
+	}
+
+	if condition == nil {
+		condition = NewLiteralExpr(semicolon, value.True)
+	}
+	body = NewWhileStmt(keyword, condition, body)
+
+	if initializer != nil {
+		body = NewBlockStmt(keyword, []Stmt{initializer, body}, end)
+	}
+
+	return body
+}
+
+func (p *Parser) ifStatement() Stmt {
+	keyword := p.previous()
+	p.consume(lexer.LEFT_PAREN, "Expect '(' after 'if'.")
+	condition := p.expression()
+	p.consume(lexer.RIGHT_PAREN, "Expect ')' after if condition.")
+
+	thenBranch := p.statement()
+	var elseBranch Stmt
+	if p.match(lexer.ELSE) {
+		elseBranch = p.statement()
+	}
+
+	return NewIfStmt(keyword, condition, thenBranch, elseBranch)
+}
+
+func (p *Parser) returnStatement() Stmt {
+	keyword := p.previous()
+
+	var value Expr
+	if !p.check(lexer.SEMICOLON) {
+		value = p.expression()
+	}
+
+	p.consume(lexer.SEMICOLON, "Expect ';' after return value.")
+	return NewReturnStmt(keyword, value)
+}
+
+func (p *Parser) whileStatement() Stmt {
+	keyword := p.previous()
+	p.consume(lexer.LEFT_PAREN, "Expect '(' after 'while'.")
+	condition := p.expression()
+	p.consume(lexer.RIGHT_PAREN, "Expect ')' after condition.")
+	body := p.statement()
+
+	return NewWhileStmt(keyword, condition, body)
+}
+
+func (p *Parser) block() []Stmt {
+	statements := []Stmt{}
+
+	for !p.check(lexer.RIGHT_BRACE) && !p.isAtEnd() {
+		statements = append(statements, p.declaration())
+	}
+
+	p.consume(lexer.RIGHT_BRACE, "Expect '}' after block.")
+	return statements
+}
+
+func (p *Parser) classDeclaration() Stmt {
+	name := p.consume(lexer.IDENTIFIER, "Expect class name.")
+
+	var superclass *VariableExpr
+	if p.match(lexer.LESS) {
+		p.consume(lexer.IDENTIFIER, "Expect superclass name.")
+		superclass = NewVariableExpr(p.previous())
+	}
+
+	p.consume(lexer.LEFT_BRACE, "Expect '{' before class body.")
+
+	methods := []*FunctionStmt{}
+	for !p.check(lexer.RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+
+	rightBrace := p.consume(lexer.RIGHT_BRACE, "Expect '}' after class body.")
+	return NewClassStmt(name, superclass, methods, rightBrace)
+}
+
+// kind is used in error messages to distinguish functions from methods
+func (p *Parser) function(kind string) *FunctionStmt {
+	name := p.consume(lexer.IDENTIFIER, "Expect "+kind+" name.")
+	p.consume(lexer.LEFT_PAREN, "Expect '(' after "+kind+" name.")
+
+	params := []lexer.Token{}
+	if !p.check(lexer.RIGHT_PAREN) {
+		for {
+			if len(params) >= maxArguments {
+				// Don't need to panic here
+				err := NewParseError(p.peek(), errors.TooManyParameters, "Can't have more than 255 parameters.")
+				p.error(err)
+			}
+			params = append(params, p.consume(lexer.IDENTIFIER, "Expect parameter name."))
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(lexer.RIGHT_PAREN, "Expect ')' after parameters.")
+
+	p.consume(lexer.LEFT_BRACE, "Expect '{' before "+kind+" body.")
+	body := p.block()
+	return NewFunctionStmt(name, params, body, p.previous())
+}
+
 func (p *Parser) varDeclaration() Stmt {
 	var initializer Expr
 	name := p.consume(lexer.IDENTIFIER, "Expect variable name.")
@@ -64,9 +247,10 @@ func (p *Parser) varDeclaration() Stmt {
 }
 
 func (p *Parser) printStatement() Stmt {
+	keyword := p.previous()
 	value := p.expression()
 	p.consume(lexer.SEMICOLON, "Expect ';' after value.")
-	return NewPrintStmt(value)
+	return NewPrintStmt(keyword, value)
 }
 
 func (p *Parser) expressionStatement() Stmt {
@@ -80,19 +264,45 @@ func (p *Parser) expression() Expr {
 }
 
 func (p *Parser) assignment() Expr {
-	expr := p.equality()
+	expr := p.or()
 
 	if p.match(lexer.EQUAL) {
 		equals := p.previous()
 		value := p.assignment()
 
-		if _, ok := expr.(VariableExpr); ok {
-			name := expr.(VariableExpr).Name
-			return NewAssignExpr(name, value)
+		if variable, ok := expr.(*VariableExpr); ok {
+			return NewAssignExpr(variable.Name, value)
+		} else if get, ok := expr.(*GetExpr); ok {
+			return NewSetExpr(get.Object, get.Name, value)
 		}
 		// Don't need to panic here
-		err := NewParseError(equals, "Invalid assignment target.")
-		err.Report()
+		err := NewParseError(equals, errors.InvalidAssignmentTarget, "Invalid assignment target.")
+		err.Help = "only variables and fields can be assigned to"
+		p.error(err)
+	}
+
+	return expr
+}
+
+func (p *Parser) or() Expr {
+	expr := p.and()
+
+	for p.match(lexer.OR) {
+		operator := p.previous()
+		right := p.and()
+		expr = NewLogicalExpr(expr, operator, right)
+	}
+
+	return expr
+}
+
+func (p *Parser) and() Expr {
+	expr := p.equality()
+
+	for p.match(lexer.AND) {
+		operator := p.previous()
+		right := p.equality()
+		expr = NewLogicalExpr(expr, operator, right)
 	}
 
 	return expr
@@ -113,7 +323,7 @@ func (p *Parser) equality() Expr {
 func (p *Parser) comparison() Expr {
 	expr := p.term()
 
-	for p.match(lexer.GREATER, lexer.GREATER_EQUAL, lexer.LESS_EQUAL) {
+	for p.match(lexer.GREATER, lexer.GREATER_EQUAL, lexer.LESS, lexer.LESS_EQUAL) {
 		operator := p.previous()
 		right := p.term()
 		expr = NewBinaryExpr(expr, operator, right)
@@ -155,20 +365,71 @@ func (p *Parser) unary() Expr {
 		return NewUnaryExpr(operator, right)
 	}
 
-	return p.primary()
+	return p.call()
+}
+
+func (p *Parser) call() Expr {
+	expr := p.primary()
+
+	for {
+		if p.match(lexer.LEFT_PAREN) {
+			expr = p.finishCall(expr)
+		} else if p.match(lexer.DOT) {
+			name := p.consume(lexer.IDENTIFIER, "Expect property name after '.'.")
+			expr = NewGetExpr(expr, name)
+		} else {
+			break
+		}
+	}
+
+	return expr
+}
+
+func (p *Parser) finishCall(callee Expr) Expr {
+	arguments := []Expr{}
+
+	if !p.check(lexer.RIGHT_PAREN) {
+		for {
+			if len(arguments) >= maxArguments {
+				// Don't need to panic here
+				err := NewParseError(p.peek(), errors.TooManyArguments, "Can't have more than 255 arguments.")
+				p.error(err)
+			}
+			arguments = append(arguments, p.expression())
+			if !p.match(lexer.COMMA) {
+				break
+			}
+		}
+	}
+
+	paren := p.consume(lexer.RIGHT_PAREN, "Expect ')' after arguments.")
+	return NewCallExpr(callee, paren, arguments)
 }
 
 func (p *Parser) primary() Expr {
 	if p.match(lexer.FALSE) {
-		return NewLiteralExpr(false)
+		return NewLiteralExpr(p.previous(), value.False)
 	} else if p.match(lexer.TRUE) {
-		return NewLiteralExpr(true)
+		return NewLiteralExpr(p.previous(), value.True)
 	} else if p.match(lexer.NIL) {
-		return NewLiteralExpr(nil)
+		return NewLiteralExpr(p.previous(), value.Nil)
+	}
+
+	if p.match(lexer.NUMBER) {
+		return NewLiteralExpr(p.previous(), value.Number(p.previous().Literal.(float64)))
+	} else if p.match(lexer.STRING) {
+		return NewLiteralExpr(p.previous(), value.String(p.previous().Literal.(string)))
 	}
 
-	if p.match(lexer.NUMBER, lexer.STRING) {
-		return NewLiteralExpr(p.previous().Literal)
+	if p.match(lexer.SUPER) {
+		keyword := p.previous()
+		p.consume(lexer.DOT, "Expect '.' after 'super'.")
+		method := p.consume(lexer.IDENTIFIER, "Expect superclass method name.")
+		return NewSuperExpr(keyword, method)
+	}
+
+	if p.match(lexer.THIS) {
+		return NewThisExpr(p.previous())
 	}
 
 	if p.match(lexer.IDENTIFIER) {
@@ -176,16 +437,13 @@ func (p *Parser) primary() Expr {
 	}
 
 	if p.match(lexer.LEFT_PAREN) {
+		leftParen := p.previous()
 		expr := p.expression()
-		p.consume(lexer.RIGHT_PAREN, "Expect ')' after expression.")
-		return NewGroupingExpr(expr)
+		rightParen := p.consume(lexer.RIGHT_PAREN, "Expect ')' after expression.")
+		return NewGroupingExpr(leftParen, expr, rightParen)
 	}
 
-	err := NewParseError(p.peek(), "Expect expression.")
-
-	if err != nil {
-		fmt.Printf("%+v", p.peek())
-	}
+	err := NewParseError(p.peek(), errors.ExpectExpression, "Expect expression.")
 	panic(err)
 }
 
@@ -194,7 +452,7 @@ func (p *Parser) consume(tokenType lexer.TokenType, message string) lexer.Token
 		return p.advance()
 	}
 
-	err := NewParseError(p.peek(), message)
+	err := NewParseError(p.peek(), expectCodes[tokenType], message)
 	panic(err)
 }
 
@@ -234,6 +492,11 @@ func (p *Parser) previous() lexer.Token {
 	return p.tokens[p.current-1]
 }
 
+func (p *Parser) error(err *ParseError) {
+	p.sink.Report(err.Diagnostic())
+	p.hadErrors = true
+}
+
 func (p *Parser) synchronize() {
 	p.advance()
 
@@ -243,14 +506,7 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peek().TokenType {
-		case lexer.CLASS:
-		case lexer.FUN:
-		case lexer.VAR:
-		case lexer.FOR:
-		case lexer.IF:
-		case lexer.WHILE:
-		case lexer.PRINT:
-		case lexer.RETURN:
+		case lexer.CLASS, lexer.FUN, lexer.VAR, lexer.FOR, lexer.IF, lexer.WHILE, lexer.PRINT, lexer.RETURN:
 			return
 		}
 		p.advance()
@@ -0,0 +1,302 @@
+package parser
+
+import (
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+)
+
+type functionType int
+
+const (
+	noFunction functionType = iota
+	inFunction
+	inInitializer
+	inMethod
+)
+
+type classType int
+
+const (
+	noClass classType = iota
+	inClass
+	inSubclass
+)
+
+// Resolver walks the syntax tree before it is interpreted and records
+// how many scopes away each local variable was declared.
+type Resolver struct {
+	sink            errors.Sink
+	interpreter     *Interpreter
+	scopes          []map[string]bool
+	currentFunction functionType
+	currentClass    classType
+	hadErrors       bool
+}
+
+// A nil interpreter only checks the program for static errors, for
+// backends that resolve variables themselves.
+func NewResolver(interpreter *Interpreter, sink errors.Sink) *Resolver {
+	return &Resolver{sink: sink, interpreter: interpreter, scopes: []map[string]bool{}, currentFunction: noFunction, currentClass: noClass}
+}
+
+func (r *Resolver) Resolve(statements []Stmt) (hadErrors bool) {
+	r.resolveStatements(statements)
+	return r.hadErrors
+}
+
+func (r *Resolver) VisitBlockStmt(stmt *BlockStmt) {
+	r.beginScope()
+	r.resolveStatements(stmt.Statements)
+	r.endScope()
+}
+
+func (r *Resolver) VisitClassStmt(stmt *ClassStmt) {
+	enclosingClass := r.currentClass
+	r.currentClass = inClass
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Name.Lexeme == stmt.Superclass.Name.Lexeme {
+			r.error(stmt.Superclass.Name, errors.InheritFromSelf, "A class can't inherit from itself.")
+		}
+
+		r.currentClass = inSubclass
+		r.resolveExpr(stmt.Superclass)
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["super"] = true
+	}
+
+	r.beginScope()
+	r.scopes[len(r.scopes)-1]["this"] = true
+
+	for _, method := range stmt.Methods {
+		kind := inMethod
+		if method.Name.Lexeme == "init" {
+			kind = inInitializer
+		}
+		r.resolveFunction(method, kind)
+	}
+
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+}
+
+func (r *Resolver) VisitExpressionStmt(stmt *ExpressionStmt) {
+	r.resolveExpr(stmt.Expression)
+}
+
+func (r *Resolver) VisitFunctionStmt(stmt *FunctionStmt) {
+	// Define eagerly so the function can refer to itself recursively
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	r.resolveFunction(stmt, inFunction)
+}
+
+func (r *Resolver) VisitIfStmt(stmt *IfStmt) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.resolveStmt(stmt.ElseBranch)
+	}
+}
+
+func (r *Resolver) VisitPrintStmt(stmt *PrintStmt) {
+	r.resolveExpr(stmt.Expression)
+}
+
+func (r *Resolver) VisitReturnStmt(stmt *ReturnStmt) {
+	if r.currentFunction == noFunction {
+		r.error(stmt.Keyword, errors.TopLevelReturn, "Can't return from top-level code.")
+	}
+
+	if stmt.Value != nil {
+		if r.currentFunction == inInitializer {
+			err := NewParseError(stmt.Keyword, errors.InitializerReturn, "Can't return a value from an initializer.")
+			err.Help = "initializers always return 'this', use a bare 'return;' instead"
+			r.report(err)
+		}
+		r.resolveExpr(stmt.Value)
+	}
+}
+
+func (r *Resolver) VisitVarStmt(stmt *VarStmt) {
+	r.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		r.resolveExpr(stmt.Initializer)
+	}
+	r.define(stmt.Name)
+}
+
+func (r *Resolver) VisitWhileStmt(stmt *WhileStmt) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+}
+
+func (r *Resolver) VisitAssignExpr(expr *AssignExpr) struct{} {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *BinaryExpr) struct{} {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitCallExpr(expr *CallExpr) struct{} {
+	r.resolveExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolveExpr(argument)
+	}
+	return struct{}{}
+}
+
+func (r *Resolver) VisitGetExpr(expr *GetExpr) struct{} {
+	r.resolveExpr(expr.Object)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *GroupingExpr) struct{} {
+	r.resolveExpr(expr.Expression)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *LiteralExpr) struct{} {
+	return struct{}{}
+}
+
+func (r *Resolver) VisitLogicalExpr(expr *LogicalExpr) struct{} {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitSetExpr(expr *SetExpr) struct{} {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitSuperExpr(expr *SuperExpr) struct{} {
+	if r.currentClass == noClass {
+		r.error(expr.Keyword, errors.SuperOutsideClass, "Can't use 'super' outside of a class.")
+	} else if r.currentClass != inSubclass {
+		r.error(expr.Keyword, errors.SuperWithoutSuperclass, "Can't use 'super' in a class with no superclass.")
+	}
+
+	r.resolveLocal(expr, expr.Keyword)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitThisExpr(expr *ThisExpr) struct{} {
+	if r.currentClass == noClass {
+		r.error(expr.Keyword, errors.ThisOutsideClass, "Can't use 'this' outside of a class.")
+		return struct{}{}
+	}
+
+	r.resolveLocal(expr, expr.Keyword)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *UnaryExpr) struct{} {
+	r.resolveExpr(expr.Right)
+	return struct{}{}
+}
+
+func (r *Resolver) VisitVariableExpr(expr *VariableExpr) struct{} {
+	if len(r.scopes) > 0 {
+		if defined, ok := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; ok && !defined {
+			r.error(expr.Name, errors.ReadInOwnInitializer, "Can't read local variable in its own initializer.")
+		}
+	}
+
+	r.resolveLocal(expr, expr.Name)
+	return struct{}{}
+}
+
+func (r *Resolver) resolveStatements(statements []Stmt) {
+	for _, stmt := range statements {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *Resolver) resolveStmt(stmt Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *Resolver) resolveExpr(expr Expr) {
+	Accept[struct{}](expr, r)
+}
+
+func (r *Resolver) resolveFunction(function *FunctionStmt, kind functionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = kind
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStatements(function.Body)
+	r.endScope()
+
+	r.currentFunction = enclosingFunction
+}
+
+// Variables not found in any scope are assumed to be global
+func (r *Resolver) resolveLocal(expr Expr, name lexer.Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			if r.interpreter != nil {
+				r.interpreter.Resolve(expr, len(r.scopes)-1-i)
+			}
+			return
+		}
+	}
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) declare(name lexer.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[name.Lexeme]; ok {
+		r.error(name, errors.DuplicateVariable, "Already a variable with this name in this scope.")
+	}
+	scope[name.Lexeme] = false
+}
+
+func (r *Resolver) define(name lexer.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme] = true
+}
+
+func (r *Resolver) error(token lexer.Token, code errors.Code, message string) {
+	r.report(NewParseError(token, code, message))
+}
+
+func (r *Resolver) report(err *ParseError) {
+	r.sink.Report(err.Diagnostic())
+	r.hadErrors = true
+}
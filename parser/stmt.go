@@ -1,30 +1,66 @@
 package parser
 
-import "github.com/maffkipp/golox/lexer"
+import (
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/span"
+)
 
+// Statement spans run from their first token to the end of their last
+// part, leaving out any terminating semicolon.
 type Stmt interface {
 	Accept(StmtVisitor)
+	Span() span.Span
 }
 
 type StmtVisitor interface {
 	VisitBlockStmt(*BlockStmt)
+	VisitClassStmt(*ClassStmt)
 	VisitExpressionStmt(*ExpressionStmt)
+	VisitFunctionStmt(*FunctionStmt)
+	VisitIfStmt(*IfStmt)
 	VisitPrintStmt(*PrintStmt)
+	VisitReturnStmt(*ReturnStmt)
 	VisitVarStmt(*VarStmt)
+	VisitWhileStmt(*WhileStmt)
 }
 
 type BlockStmt struct {
+	LeftBrace  lexer.Token
 	Statements []Stmt
+	RightBrace lexer.Token
 }
 
-func NewBlockStmt(statements []Stmt) *BlockStmt {
-	return &BlockStmt{Statements: statements}
+func NewBlockStmt(leftBrace lexer.Token, statements []Stmt, rightBrace lexer.Token) *BlockStmt {
+	return &BlockStmt{LeftBrace: leftBrace, Statements: statements, RightBrace: rightBrace}
 }
 
 func (b *BlockStmt) Accept(visitor StmtVisitor) {
 	visitor.VisitBlockStmt(b)
 }
 
+func (b *BlockStmt) Span() span.Span {
+	return b.LeftBrace.Span.Join(b.RightBrace.Span)
+}
+
+type ClassStmt struct {
+	Name       lexer.Token
+	Superclass *VariableExpr
+	Methods    []*FunctionStmt
+	RightBrace lexer.Token
+}
+
+func NewClassStmt(name lexer.Token, superclass *VariableExpr, methods []*FunctionStmt, rightBrace lexer.Token) *ClassStmt {
+	return &ClassStmt{Name: name, Superclass: superclass, Methods: methods, RightBrace: rightBrace}
+}
+
+func (c *ClassStmt) Accept(visitor StmtVisitor) {
+	visitor.VisitClassStmt(c)
+}
+
+func (c *ClassStmt) Span() span.Span {
+	return c.Name.Span.Join(c.RightBrace.Span)
+}
+
 type ExpressionStmt struct {
 	Expression Expr
 }
@@ -37,18 +73,88 @@ func (e *ExpressionStmt) Accept(visitor StmtVisitor) {
 	visitor.VisitExpressionStmt(e)
 }
 
+func (e *ExpressionStmt) Span() span.Span {
+	return e.Expression.Span()
+}
+
+type FunctionStmt struct {
+	Name       lexer.Token
+	Params     []lexer.Token
+	Body       []Stmt
+	RightBrace lexer.Token
+}
+
+func NewFunctionStmt(name lexer.Token, params []lexer.Token, body []Stmt, rightBrace lexer.Token) *FunctionStmt {
+	return &FunctionStmt{Name: name, Params: params, Body: body, RightBrace: rightBrace}
+}
+
+func (f *FunctionStmt) Accept(visitor StmtVisitor) {
+	visitor.VisitFunctionStmt(f)
+}
+
+func (f *FunctionStmt) Span() span.Span {
+	return f.Name.Span.Join(f.RightBrace.Span)
+}
+
+type IfStmt struct {
+	Keyword    lexer.Token
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func NewIfStmt(keyword lexer.Token, condition Expr, thenBranch Stmt, elseBranch Stmt) *IfStmt {
+	return &IfStmt{Keyword: keyword, Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+}
+
+func (i *IfStmt) Accept(visitor StmtVisitor) {
+	visitor.VisitIfStmt(i)
+}
+
+func (i *IfStmt) Span() span.Span {
+	if i.ElseBranch != nil {
+		return i.Keyword.Span.Join(i.ElseBranch.Span())
+	}
+	return i.Keyword.Span.Join(i.ThenBranch.Span())
+}
+
 type PrintStmt struct {
+	Keyword    lexer.Token
 	Expression Expr
 }
 
-func NewPrintStmt(expression Expr) *PrintStmt {
-	return &PrintStmt{Expression: expression}
+func NewPrintStmt(keyword lexer.Token, expression Expr) *PrintStmt {
+	return &PrintStmt{Keyword: keyword, Expression: expression}
 }
 
 func (p *PrintStmt) Accept(visitor StmtVisitor) {
 	visitor.VisitPrintStmt(p)
 }
 
+func (p *PrintStmt) Span() span.Span {
+	return p.Keyword.Span.Join(p.Expression.Span())
+}
+
+type ReturnStmt struct {
+	Keyword lexer.Token
+	Value   Expr
+}
+
+func NewReturnStmt(keyword lexer.Token, value Expr) *ReturnStmt {
+	return &ReturnStmt{Keyword: keyword, Value: value}
+}
+
+func (r *ReturnStmt) Accept(visitor StmtVisitor) {
+	visitor.VisitReturnStmt(r)
+}
+
+func (r *ReturnStmt) Span() span.Span {
+	if r.Value != nil {
+		return r.Keyword.Span.Join(r.Value.Span())
+	}
+	return r.Keyword.Span
+}
+
 type VarStmt struct {
 	Name        lexer.Token
 	Initializer Expr
@@ -61,3 +167,28 @@ func NewVarStmt(name lexer.Token, initializer Expr) *VarStmt {
 func (v *VarStmt) Accept(visitor StmtVisitor) {
 	visitor.VisitVarStmt(v)
 }
+
+func (v *VarStmt) Span() span.Span {
+	if v.Initializer != nil {
+		return v.Name.Span.Join(v.Initializer.Span())
+	}
+	return v.Name.Span
+}
+
+type WhileStmt struct {
+	Keyword   lexer.Token
+	Condition Expr
+	Body      Stmt
+}
+
+func NewWhileStmt(keyword lexer.Token, condition Expr, body Stmt) *WhileStmt {
+	return &WhileStmt{Keyword: keyword, Condition: condition, Body: body}
+}
+
+func (w *WhileStmt) Accept(visitor StmtVisitor) {
+	visitor.VisitWhileStmt(w)
+}
+
+func (w *WhileStmt) Span() span.Span {
+	return w.Keyword.Span.Join(w.Body.Span())
+}
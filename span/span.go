@@ -0,0 +1,29 @@
+package span
+
+import "fmt"
+
+// Span locates a run of source text. Line and Column are 1-based and
+// mark where the text begins, Column counting characters rather than
+// bytes. Start and End are the byte offsets [Start, End) into the file.
+type Span struct {
+	File   string
+	Line   int
+	Column int
+	Start  int
+	End    int
+}
+
+// Join returns a span running from the start of s to the end of other
+func (s Span) Join(other Span) Span {
+	if other.End > s.End {
+		s.End = other.End
+	}
+	return s
+}
+
+func (s Span) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("%d:%d", s.Line, s.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
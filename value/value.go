@@ -0,0 +1,167 @@
+// Package value defines the representation of Lox values shared by the
+// interpreter, the virtual machine and the embedding API.
+package value
+
+import "strconv"
+
+type Kind uint8
+
+const (
+	KindNil Kind = iota
+	KindBool
+	KindNumber
+	KindString
+	KindObject
+)
+
+var kindNames = [...]string{"nil", "boolean", "number", "string", "object"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Object is implemented by every value with identity: functions,
+// classes, instances and collections
+type Object interface {
+	String() string
+}
+
+// Value is a Lox value tagged with its kind. It takes three words: ref
+// holds a string or an Object, or for the other kinds a marker whose
+// type is the kind, and number holds numbers and booleans as 0 or 1.
+// Numbers and booleans are stored inline so producing them never
+// allocates. The zero Value is nil.
+type Value struct {
+	ref    any
+	number float64
+}
+
+// The markers are zero sized, so storing them in ref does not allocate
+// and testing for one compares only the type word
+type (
+	boolMarker   struct{}
+	numberMarker struct{}
+)
+
+var (
+	Nil   = Value{}
+	True  = Value{ref: boolMarker{}, number: 1}
+	False = Value{ref: boolMarker{}}
+)
+
+func Bool(b bool) Value {
+	if b {
+		return True
+	}
+	return False
+}
+
+func Number(n float64) Value {
+	return Value{ref: numberMarker{}, number: n}
+}
+
+func String(s string) Value {
+	return Value{ref: s}
+}
+
+func Obj(o Object) Value {
+	return Value{ref: o}
+}
+
+func (v Value) Kind() Kind {
+	switch v.ref.(type) {
+	case nil:
+		return KindNil
+	case boolMarker:
+		return KindBool
+	case numberMarker:
+		return KindNumber
+	case string:
+		return KindString
+	}
+	return KindObject
+}
+
+func (v Value) IsNil() bool {
+	return v.ref == nil
+}
+
+func (v Value) IsBool() bool {
+	_, ok := v.ref.(boolMarker)
+	return ok
+}
+
+func (v Value) IsNumber() bool {
+	_, ok := v.ref.(numberMarker)
+	return ok
+}
+
+func (v Value) IsString() bool {
+	_, ok := v.ref.(string)
+	return ok
+}
+
+func (v Value) IsObject() bool {
+	_, ok := v.ref.(Object)
+	return ok
+}
+
+// The As methods return the content of a value known to be of their kind
+func (v Value) AsBool() bool {
+	return v.number != 0
+}
+
+func (v Value) AsNumber() float64 {
+	return v.number
+}
+
+func (v Value) AsString() string {
+	return v.ref.(string)
+}
+
+func (v Value) AsObject() Object {
+	return v.ref.(Object)
+}
+
+// Truthy reports whether v counts as true in a condition: everything
+// except nil and false does
+func (v Value) Truthy() bool {
+	switch v.ref.(type) {
+	case nil:
+		return false
+	case boolMarker:
+		return v.AsBool()
+	}
+	return true
+}
+
+// Equal compares numbers, strings and booleans by value and objects by
+// identity. Values of different kinds are never equal.
+func Equal(a, b Value) bool {
+	return a == b
+}
+
+// String formats v the way print shows it
+func (v Value) String() string {
+	switch v.Kind() {
+	case KindNil:
+		return "nil"
+	case KindBool:
+		return strconv.FormatBool(v.AsBool())
+	case KindNumber:
+		return strconv.FormatFloat(v.number, 'g', -1, 64)
+	case KindString:
+		return v.AsString()
+	}
+	return v.AsObject().String()
+}
+
+// As returns the object held by v when v is an object of type T
+func As[T any](v Value) (T, bool) {
+	if _, ok := v.ref.(Object); !ok {
+		var zero T
+		return zero, false
+	}
+	o, ok := v.ref.(T)
+	return o, ok
+}
@@ -0,0 +1,123 @@
+package vm
+
+import (
+	"github.com/maffkipp/golox/span"
+	"github.com/maffkipp/golox/value"
+)
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_GET_SUPER
+	OP_EQUAL
+	OP_GREATER
+	OP_LESS
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_INVOKE
+	OP_SUPER_INVOKE
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS
+	OP_INHERIT
+	OP_METHOD
+)
+
+var opNames = [...]string{
+	"OP_CONSTANT",
+	"OP_NIL",
+	"OP_TRUE",
+	"OP_FALSE",
+	"OP_POP",
+	"OP_GET_LOCAL",
+	"OP_SET_LOCAL",
+	"OP_GET_GLOBAL",
+	"OP_DEFINE_GLOBAL",
+	"OP_SET_GLOBAL",
+	"OP_GET_UPVALUE",
+	"OP_SET_UPVALUE",
+	"OP_GET_PROPERTY",
+	"OP_SET_PROPERTY",
+	"OP_GET_SUPER",
+	"OP_EQUAL",
+	"OP_GREATER",
+	"OP_LESS",
+	"OP_ADD",
+	"OP_SUBTRACT",
+	"OP_MULTIPLY",
+	"OP_DIVIDE",
+	"OP_NOT",
+	"OP_NEGATE",
+	"OP_PRINT",
+	"OP_JUMP",
+	"OP_JUMP_IF_FALSE",
+	"OP_LOOP",
+	"OP_CALL",
+	"OP_INVOKE",
+	"OP_SUPER_INVOKE",
+	"OP_CLOSURE",
+	"OP_CLOSE_UPVALUE",
+	"OP_RETURN",
+	"OP_CLASS",
+	"OP_INHERIT",
+	"OP_METHOD",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "OP_UNKNOWN"
+}
+
+// Chunk is a sequence of bytecode with the constants it refers to.
+// Spans records the source position of every byte of Code and serves as
+// the line table.
+type Chunk struct {
+	Code      []byte
+	Constants []value.Value
+	Spans     []span.Span
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{}
+}
+
+func (c *Chunk) Write(b byte, sp span.Span) {
+	c.Code = append(c.Code, b)
+	c.Spans = append(c.Spans, sp)
+}
+
+// AddConstant returns the index of val in the constant pool
+func (c *Chunk) AddConstant(val value.Value) int {
+	c.Constants = append(c.Constants, val)
+	return len(c.Constants) - 1
+}
+
+func (c *Chunk) Line(offset int) int {
+	return c.Spans[offset].Line
+}
@@ -0,0 +1,620 @@
+package vm
+
+import (
+	"math"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/span"
+	"github.com/maffkipp/golox/value"
+)
+
+// Operands are single bytes, which limits how many of each a function
+// can refer to
+const (
+	maxLocals   = math.MaxUint8 + 1
+	maxUpvalues = math.MaxUint8 + 1
+)
+
+type functionKind int
+
+const (
+	kindScript functionKind = iota
+	kindFunction
+	kindMethod
+	kindInitializer
+)
+
+type local struct {
+	name string
+	// depth is -1 until the variable's initializer has been compiled
+	depth      int
+	isCaptured bool
+}
+
+type upvalue struct {
+	index   byte
+	isLocal bool
+}
+
+// funcState is the state of one function being compiled. Functions
+// nested inside it are compiled with their own state linked to it.
+type funcState struct {
+	enclosing  *funcState
+	function   *Function
+	kind       functionKind
+	locals     []local
+	upvalues   []upvalue
+	scopeDepth int
+	// names maps identifiers to their constant so each is stored once
+	names map[string]byte
+}
+
+type classState struct {
+	enclosing     *classState
+	hasSuperclass bool
+}
+
+// Compiler turns a resolved syntax tree into bytecode. Static errors are
+// expected to have been reported by the parser's Resolver already, so
+// the compiler only reports the limits of the bytecode format.
+type Compiler struct {
+	sink      errors.Sink
+	current   *funcState
+	class     *classState
+	hadErrors bool
+}
+
+func NewCompiler(sink errors.Sink) *Compiler {
+	return &Compiler{sink: sink}
+}
+
+// Compile returns the top level of the program as a function of no
+// arguments
+func (c *Compiler) Compile(statements []parser.Stmt) (function *Function, hadErrors bool) {
+	c.begin(kindScript, "")
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+
+	end := span.Span{}
+	if len(statements) > 0 {
+		end = statements[len(statements)-1].Span()
+	}
+	c.emitReturn(end)
+	return c.end(), c.hadErrors
+}
+
+func (c *Compiler) begin(kind functionKind, name string) {
+	state := &funcState{enclosing: c.current, function: NewFunction(name), kind: kind, names: make(map[string]byte)}
+
+	// Slot zero holds the function being called, or "this" in methods
+	slotZero := ""
+	if kind == kindMethod || kind == kindInitializer {
+		slotZero = "this"
+	}
+	state.locals = append(state.locals, local{name: slotZero})
+
+	c.current = state
+}
+
+func (c *Compiler) end() *Function {
+	function := c.current.function
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) VisitExpressionStmt(stmt *parser.ExpressionStmt) {
+	c.expression(stmt.Expression)
+	c.emitOp(stmt.Span(), OP_POP)
+}
+
+func (c *Compiler) VisitPrintStmt(stmt *parser.PrintStmt) {
+	c.expression(stmt.Expression)
+	c.emitOp(stmt.Span(), OP_PRINT)
+}
+
+func (c *Compiler) VisitVarStmt(stmt *parser.VarStmt) {
+	global := c.declareVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emitOp(stmt.Span(), OP_NIL)
+	}
+
+	c.defineVariable(stmt.Span(), global)
+}
+
+func (c *Compiler) VisitBlockStmt(stmt *parser.BlockStmt) {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		c.statement(s)
+	}
+	c.endScope(stmt.RightBrace.Span)
+}
+
+func (c *Compiler) VisitIfStmt(stmt *parser.IfStmt) {
+	sp := stmt.Keyword.Span
+
+	c.expression(stmt.Condition)
+	thenJump := c.emitJump(sp, OP_JUMP_IF_FALSE)
+	c.emitOp(sp, OP_POP)
+	c.statement(stmt.ThenBranch)
+
+	elseJump := c.emitJump(sp, OP_JUMP)
+	c.patchJump(sp, thenJump)
+	c.emitOp(sp, OP_POP)
+	if stmt.ElseBranch != nil {
+		c.statement(stmt.ElseBranch)
+	}
+	c.patchJump(sp, elseJump)
+}
+
+func (c *Compiler) VisitWhileStmt(stmt *parser.WhileStmt) {
+	sp := stmt.Keyword.Span
+
+	loopStart := len(c.chunk().Code)
+	c.expression(stmt.Condition)
+
+	exitJump := c.emitJump(sp, OP_JUMP_IF_FALSE)
+	c.emitOp(sp, OP_POP)
+	c.statement(stmt.Body)
+	c.emitLoop(sp, loopStart)
+
+	c.patchJump(sp, exitJump)
+	c.emitOp(sp, OP_POP)
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt *parser.FunctionStmt) {
+	global := c.declareVariable(stmt.Name)
+	// a local function can refer to itself before its body is compiled
+	c.markInitialized()
+	c.function(stmt, kindFunction)
+	c.defineVariable(stmt.Span(), global)
+}
+
+func (c *Compiler) VisitReturnStmt(stmt *parser.ReturnStmt) {
+	if stmt.Value == nil {
+		c.emitReturn(stmt.Span())
+		return
+	}
+
+	c.expression(stmt.Value)
+	c.emitOp(stmt.Span(), OP_RETURN)
+}
+
+func (c *Compiler) VisitClassStmt(stmt *parser.ClassStmt) {
+	sp := stmt.Name.Span
+	name := c.identifierConstant(stmt.Name)
+
+	global := c.declareVariable(stmt.Name)
+	c.emitOp(sp, OP_CLASS, name)
+	c.defineVariable(sp, global)
+
+	c.class = &classState{enclosing: c.class}
+
+	// Methods capture the superclass from a scope of its own holding "super"
+	if stmt.Superclass != nil {
+		c.expression(stmt.Superclass)
+		c.beginScope()
+		c.addLocal(lexer.Token{Lexeme: "super", Span: stmt.Superclass.Span()})
+		c.markInitialized()
+
+		c.namedVariable(stmt.Name.Lexeme, sp)
+		c.emitOp(stmt.Superclass.Span(), OP_INHERIT)
+		c.class.hasSuperclass = true
+	}
+
+	// the class stays on the stack while its methods are added
+	c.namedVariable(stmt.Name.Lexeme, sp)
+	for _, method := range stmt.Methods {
+		kind := kindMethod
+		if method.Name.Lexeme == "init" {
+			kind = kindInitializer
+		}
+		c.function(method, kind)
+		c.emitOp(method.Name.Span, OP_METHOD, c.identifierConstant(method.Name))
+	}
+	c.emitOp(stmt.RightBrace.Span, OP_POP)
+
+	if c.class.hasSuperclass {
+		c.endScope(stmt.RightBrace.Span)
+	}
+	c.class = c.class.enclosing
+}
+
+func (c *Compiler) VisitLiteralExpr(expr *parser.LiteralExpr) struct{} {
+	sp := expr.Span()
+	switch expr.Value {
+	case value.Nil:
+		c.emitOp(sp, OP_NIL)
+	case value.True:
+		c.emitOp(sp, OP_TRUE)
+	case value.False:
+		c.emitOp(sp, OP_FALSE)
+	default:
+		c.emitConstant(sp, expr.Value)
+	}
+	return struct{}{}
+}
+
+func (c *Compiler) VisitGroupingExpr(expr *parser.GroupingExpr) struct{} {
+	c.expression(expr.Expression)
+	return struct{}{}
+}
+
+func (c *Compiler) VisitUnaryExpr(expr *parser.UnaryExpr) struct{} {
+	c.expression(expr.Right)
+
+	sp := expr.Operator.Span
+	switch expr.Operator.TokenType {
+	case lexer.BANG:
+		c.emitOp(sp, OP_NOT)
+	case lexer.MINUS:
+		c.emitOp(sp, OP_NEGATE)
+	}
+	return struct{}{}
+}
+
+func (c *Compiler) VisitBinaryExpr(expr *parser.BinaryExpr) struct{} {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+
+	sp := expr.Operator.Span
+	switch expr.Operator.TokenType {
+	case lexer.BANG_EQUAL:
+		c.emitOp(sp, OP_EQUAL)
+		c.emitOp(sp, OP_NOT)
+	case lexer.EQUAL_EQUAL:
+		c.emitOp(sp, OP_EQUAL)
+	case lexer.GREATER:
+		c.emitOp(sp, OP_GREATER)
+	case lexer.GREATER_EQUAL:
+		c.emitOp(sp, OP_LESS)
+		c.emitOp(sp, OP_NOT)
+	case lexer.LESS:
+		c.emitOp(sp, OP_LESS)
+	case lexer.LESS_EQUAL:
+		c.emitOp(sp, OP_GREATER)
+		c.emitOp(sp, OP_NOT)
+	case lexer.PLUS:
+		c.emitOp(sp, OP_ADD)
+	case lexer.MINUS:
+		c.emitOp(sp, OP_SUBTRACT)
+	case lexer.STAR:
+		c.emitOp(sp, OP_MULTIPLY)
+	case lexer.SLASH:
+		c.emitOp(sp, OP_DIVIDE)
+	}
+	return struct{}{}
+}
+
+// The left operand is left on the stack as the result when it decides
+// the outcome
+func (c *Compiler) VisitLogicalExpr(expr *parser.LogicalExpr) struct{} {
+	sp := expr.Operator.Span
+	c.expression(expr.Left)
+
+	if expr.Operator.TokenType == lexer.AND {
+		endJump := c.emitJump(sp, OP_JUMP_IF_FALSE)
+		c.emitOp(sp, OP_POP)
+		c.expression(expr.Right)
+		c.patchJump(sp, endJump)
+		return struct{}{}
+	}
+
+	elseJump := c.emitJump(sp, OP_JUMP_IF_FALSE)
+	endJump := c.emitJump(sp, OP_JUMP)
+	c.patchJump(sp, elseJump)
+	c.emitOp(sp, OP_POP)
+	c.expression(expr.Right)
+	c.patchJump(sp, endJump)
+	return struct{}{}
+}
+
+func (c *Compiler) VisitVariableExpr(expr *parser.VariableExpr) struct{} {
+	c.namedVariable(expr.Name.Lexeme, expr.Span())
+	return struct{}{}
+}
+
+func (c *Compiler) VisitAssignExpr(expr *parser.AssignExpr) struct{} {
+	c.expression(expr.Value)
+
+	sp := expr.Span()
+	if slot := resolveLocal(c.current, expr.Name.Lexeme); slot != -1 {
+		c.emitOp(sp, OP_SET_LOCAL, byte(slot))
+	} else if index := c.resolveUpvalue(c.current, expr.Name.Lexeme, sp); index != -1 {
+		c.emitOp(sp, OP_SET_UPVALUE, byte(index))
+	} else {
+		c.emitOp(sp, OP_SET_GLOBAL, c.identifierConstant(expr.Name))
+	}
+	return struct{}{}
+}
+
+// Calling a property or a superclass method compiles to a single
+// instruction, saving the bound method a separate get would create
+func (c *Compiler) VisitCallExpr(expr *parser.CallExpr) struct{} {
+	sp := expr.Span()
+
+	switch callee := expr.Callee.(type) {
+	case *parser.GetExpr:
+		c.expression(callee.Object)
+		argCount := c.arguments(expr.Arguments)
+		c.emitOp(sp, OP_INVOKE, c.identifierConstant(callee.Name), argCount)
+	case *parser.SuperExpr:
+		c.namedVariable("this", callee.Keyword.Span)
+		argCount := c.arguments(expr.Arguments)
+		c.namedVariable("super", callee.Keyword.Span)
+		c.emitOp(sp, OP_SUPER_INVOKE, c.identifierConstant(callee.Method), argCount)
+	default:
+		c.expression(expr.Callee)
+		argCount := c.arguments(expr.Arguments)
+		c.emitOp(sp, OP_CALL, argCount)
+	}
+	return struct{}{}
+}
+
+func (c *Compiler) VisitGetExpr(expr *parser.GetExpr) struct{} {
+	c.expression(expr.Object)
+	c.emitOp(expr.Name.Span, OP_GET_PROPERTY, c.identifierConstant(expr.Name))
+	return struct{}{}
+}
+
+func (c *Compiler) VisitSetExpr(expr *parser.SetExpr) struct{} {
+	c.expression(expr.Object)
+	c.expression(expr.Value)
+	c.emitOp(expr.Name.Span, OP_SET_PROPERTY, c.identifierConstant(expr.Name))
+	return struct{}{}
+}
+
+func (c *Compiler) VisitSuperExpr(expr *parser.SuperExpr) struct{} {
+	sp := expr.Span()
+	c.namedVariable("this", sp)
+	c.namedVariable("super", sp)
+	c.emitOp(expr.Method.Span, OP_GET_SUPER, c.identifierConstant(expr.Method))
+	return struct{}{}
+}
+
+func (c *Compiler) VisitThisExpr(expr *parser.ThisExpr) struct{} {
+	c.namedVariable("this", expr.Span())
+	return struct{}{}
+}
+
+func (c *Compiler) statement(stmt parser.Stmt) {
+	stmt.Accept(c)
+}
+
+func (c *Compiler) expression(expr parser.Expr) {
+	parser.Accept[struct{}](expr, c)
+}
+
+func (c *Compiler) arguments(arguments []parser.Expr) byte {
+	for _, argument := range arguments {
+		c.expression(argument)
+	}
+	// the parser already limits calls to 255 arguments
+	return byte(len(arguments))
+}
+
+// function compiles the body of stmt and emits the closure that creates
+// it at run time
+func (c *Compiler) function(stmt *parser.FunctionStmt, kind functionKind) {
+	c.begin(kind, stmt.Name.Lexeme)
+	c.beginScope()
+
+	for _, param := range stmt.Params {
+		c.current.function.Arity++
+		c.declareVariable(param)
+		c.markInitialized()
+	}
+	for _, s := range stmt.Body {
+		c.statement(s)
+	}
+	c.emitReturn(stmt.RightBrace.Span)
+
+	// the upvalues are read before end discards the function's state
+	upvalues := c.current.upvalues
+	function := c.end()
+
+	sp := stmt.Span()
+	c.emitOp(sp, OP_CLOSURE, c.makeConstant(sp, value.Obj(function)))
+	for _, uv := range upvalues {
+		isLocal := byte(0)
+		if uv.isLocal {
+			isLocal = 1
+		}
+		c.emit(sp, isLocal, uv.index)
+	}
+}
+
+// namedVariable emits the instruction that reads the variable called name
+func (c *Compiler) namedVariable(name string, sp span.Span) {
+	if slot := resolveLocal(c.current, name); slot != -1 {
+		c.emitOp(sp, OP_GET_LOCAL, byte(slot))
+	} else if index := c.resolveUpvalue(c.current, name, sp); index != -1 {
+		c.emitOp(sp, OP_GET_UPVALUE, byte(index))
+	} else {
+		c.emitOp(sp, OP_GET_GLOBAL, c.identifierConstant(lexer.Token{Lexeme: name, Span: sp}))
+	}
+}
+
+// declareVariable adds a local for name inside a scope, or returns the
+// constant holding the name of a global at the top level
+func (c *Compiler) declareVariable(name lexer.Token) byte {
+	if c.current.scopeDepth == 0 {
+		return c.identifierConstant(name)
+	}
+	c.addLocal(name)
+	return 0
+}
+
+// defineVariable makes a declared variable available once its value is
+// on top of the stack
+func (c *Compiler) defineVariable(sp span.Span, global byte) {
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitOp(sp, OP_DEFINE_GLOBAL, global)
+}
+
+func (c *Compiler) addLocal(name lexer.Token) {
+	if len(c.current.locals) == maxLocals {
+		c.error(name.Span, errors.TooManyLocals, "Too many local variables in function.")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: -1})
+}
+
+func (c *Compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+func resolveLocal(state *funcState, name string) int {
+	for i := len(state.locals) - 1; i >= 0; i-- {
+		if state.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue looks for name in the enclosing functions, capturing it
+// in each function in between
+func (c *Compiler) resolveUpvalue(state *funcState, name string, sp span.Span) int {
+	if state.enclosing == nil {
+		return -1
+	}
+
+	if slot := resolveLocal(state.enclosing, name); slot != -1 {
+		state.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(state, byte(slot), true, sp)
+	}
+
+	if index := c.resolveUpvalue(state.enclosing, name, sp); index != -1 {
+		return c.addUpvalue(state, byte(index), false, sp)
+	}
+
+	return -1
+}
+
+func (c *Compiler) addUpvalue(state *funcState, index byte, isLocal bool, sp span.Span) int {
+	for i, uv := range state.upvalues {
+		if uv.index == index && uv.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(state.upvalues) == maxUpvalues {
+		c.error(sp, errors.TooManyUpvalues, "Too many closure variables in function.")
+		return 0
+	}
+
+	state.upvalues = append(state.upvalues, upvalue{index: index, isLocal: isLocal})
+	state.function.UpvalueCount = len(state.upvalues)
+	return len(state.upvalues) - 1
+}
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope discards the scope's locals, moving captured ones off the stack
+func (c *Compiler) endScope(sp span.Span) {
+	state := c.current
+	state.scopeDepth--
+
+	for len(state.locals) > 0 && state.locals[len(state.locals)-1].depth > state.scopeDepth {
+		if state.locals[len(state.locals)-1].isCaptured {
+			c.emitOp(sp, OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(sp, OP_POP)
+		}
+		state.locals = state.locals[:len(state.locals)-1]
+	}
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.function.Chunk
+}
+
+func (c *Compiler) emit(sp span.Span, bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().Write(b, sp)
+	}
+}
+
+func (c *Compiler) emitOp(sp span.Span, op OpCode, operands ...byte) {
+	c.emit(sp, byte(op))
+	c.emit(sp, operands...)
+}
+
+func (c *Compiler) emitConstant(sp span.Span, val value.Value) {
+	c.emitOp(sp, OP_CONSTANT, c.makeConstant(sp, val))
+}
+
+// Initializers always return "this"
+func (c *Compiler) emitReturn(sp span.Span) {
+	if c.current.kind == kindInitializer {
+		c.emitOp(sp, OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(sp, OP_NIL)
+	}
+	c.emitOp(sp, OP_RETURN)
+}
+
+// emitJump emits a jump with a placeholder offset, returning where the
+// offset is to be patched
+func (c *Compiler) emitJump(sp span.Span, op OpCode) int {
+	c.emitOp(sp, op, 0xff, 0xff)
+	return len(c.chunk().Code) - 2
+}
+
+// patchJump points the jump at offset to the next instruction
+func (c *Compiler) patchJump(sp span.Span, offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > math.MaxUint16 {
+		c.error(sp, errors.JumpTooLarge, "Too much code to jump over.")
+	}
+
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(sp span.Span, loopStart int) {
+	c.emitOp(sp, OP_LOOP)
+
+	offset := len(c.chunk().Code) - loopStart + 2
+	if offset > math.MaxUint16 {
+		c.error(sp, errors.JumpTooLarge, "Loop body too large.")
+	}
+	c.emit(sp, byte(offset>>8), byte(offset))
+}
+
+func (c *Compiler) makeConstant(sp span.Span, val value.Value) byte {
+	index := c.chunk().AddConstant(val)
+	if index > math.MaxUint8 {
+		c.error(sp, errors.TooManyConstants, "Too many constants in one chunk.")
+		return 0
+	}
+	return byte(index)
+}
+
+func (c *Compiler) identifierConstant(name lexer.Token) byte {
+	if index, ok := c.current.names[name.Lexeme]; ok {
+		return index
+	}
+	index := c.makeConstant(name.Span, value.String(name.Lexeme))
+	c.current.names[name.Lexeme] = index
+	return index
+}
+
+func (c *Compiler) error(sp span.Span, code errors.Code, message string) {
+	c.sink.Report(errors.Diagnostic{Code: code, Span: sp, Message: message})
+	c.hadErrors = true
+}
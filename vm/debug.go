@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/maffkipp/golox/value"
+)
+
+// Disassemble writes the instructions of function, followed by those of
+// every function defined inside it
+func Disassemble(w io.Writer, function *Function) {
+	fmt.Fprintf(w, "== %s ==\n", function)
+
+	chunk := function.Chunk
+	for offset := 0; offset < len(chunk.Code); {
+		offset = DisassembleInstruction(w, chunk, offset)
+	}
+
+	for _, constant := range chunk.Constants {
+		if nested, ok := value.As[*Function](constant); ok {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+// DisassembleInstruction writes the instruction at offset with its
+// source line and decoded operands, returning the offset of the next
+// instruction. The line is shown as "|" when it is the same as the
+// previous instruction's.
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.Line(offset) == chunk.Line(offset-1) {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.Line(offset))
+	}
+
+	op := OpCode(chunk.Code[offset])
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL, OP_GET_PROPERTY,
+		OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		return constantInstruction(w, op, chunk, offset)
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		return byteInstruction(w, op, chunk, offset)
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		return jumpInstruction(w, op, 1, chunk, offset)
+	case OP_LOOP:
+		return jumpInstruction(w, op, -1, chunk, offset)
+	case OP_INVOKE, OP_SUPER_INVOKE:
+		return invokeInstruction(w, op, chunk, offset)
+	case OP_CLOSURE:
+		return closureInstruction(w, chunk, offset)
+	}
+
+	fmt.Fprintln(w, op)
+	return offset + 1
+}
+
+func constantInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant := chunk.Code[offset+1]
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", op, constant, chunk.Constants[constant])
+	return offset + 2
+}
+
+func byteInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%-16s %4d\n", op, chunk.Code[offset+1])
+	return offset + 2
+}
+
+// sign is -1 for jumps backwards
+func jumpInstruction(w io.Writer, op OpCode, sign int, chunk *Chunk, offset int) int {
+	jump := int(chunk.Code[offset+1])<<8 | int(chunk.Code[offset+2])
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+sign*jump)
+	return offset + 3
+}
+
+func invokeInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant := chunk.Code[offset+1]
+	argCount := chunk.Code[offset+2]
+	fmt.Fprintf(w, "%-16s (%d args) %4d '%s'\n", op, argCount, constant, chunk.Constants[constant])
+	return offset + 3
+}
+
+// The closure's operands are followed by a pair of bytes for each
+// variable it captures
+func closureInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	constant := chunk.Code[offset+1]
+	function := chunk.Constants[constant].AsObject().(*Function)
+	fmt.Fprintf(w, "%-16s %4d %s\n", OP_CLOSURE, constant, function)
+
+	offset += 2
+	for i := 0; i < function.UpvalueCount; i++ {
+		kind := "upvalue"
+		if chunk.Code[offset] == 1 {
+			kind = "local"
+		}
+		fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+		offset += 2
+	}
+	return offset
+}
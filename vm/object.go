@@ -0,0 +1,104 @@
+package vm
+
+import "github.com/maffkipp/golox/value"
+
+// Function is a compiled function body. The top level of a script is
+// compiled to a function without a name.
+type Function struct {
+	Name         string
+	Arity        int
+	UpvalueCount int
+	Chunk        *Chunk
+}
+
+func NewFunction(name string) *Function {
+	return &Function{Name: name, Chunk: NewChunk()}
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return "<fn " + f.Name + ">"
+}
+
+// Closure pairs a function with the variables it captured
+type Closure struct {
+	Function *Function
+	Upvalues []*Upvalue
+}
+
+func NewClosure(function *Function) *Closure {
+	return &Closure{Function: function, Upvalues: make([]*Upvalue, function.UpvalueCount)}
+}
+
+func (c *Closure) String() string {
+	return c.Function.String()
+}
+
+// Upvalue is a variable captured by a closure. While the variable is
+// still on the stack location points at its slot; once it goes out of
+// scope the value moves into closed and location points there.
+type Upvalue struct {
+	location *value.Value
+	closed   value.Value
+	// slot is the stack index of an open upvalue
+	slot int
+	// next links the open upvalues in order of decreasing slot
+	next *Upvalue
+}
+
+type Native struct {
+	Name  string
+	Arity int
+	Fn    func(arguments []value.Value) (value.Value, error)
+}
+
+func NewNative(name string, arity int, fn func(arguments []value.Value) (value.Value, error)) *Native {
+	return &Native{Name: name, Arity: arity, Fn: fn}
+}
+
+func (n *Native) String() string {
+	return "<native fn>"
+}
+
+type Class struct {
+	Name    string
+	Methods map[string]*Closure
+}
+
+func NewClass(name string) *Class {
+	return &Class{Name: name, Methods: make(map[string]*Closure)}
+}
+
+func (c *Class) String() string {
+	return c.Name
+}
+
+type Instance struct {
+	Class  *Class
+	Fields map[string]value.Value
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{Class: class, Fields: make(map[string]value.Value)}
+}
+
+func (i *Instance) String() string {
+	return i.Class.Name + " instance"
+}
+
+// BoundMethod is a method read from an instance, remembering the
+// instance as "this"
+type BoundMethod struct {
+	Receiver value.Value
+	Method   *Closure
+}
+
+func NewBoundMethod(receiver value.Value, method *Closure) *BoundMethod {
+	return &BoundMethod{Receiver: receiver, Method: method}
+}
+
+func (b *BoundMethod) String() string {
+	return b.Method.String()
+}
@@ -0,0 +1,484 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/parser"
+	"github.com/maffkipp/golox/value"
+)
+
+const (
+	// framesMax allows the script's own frame and as many nested calls
+	// as the tree-walker does
+	framesMax = parser.DefaultMaxCallDepth + 1
+	// stackMax gives each frame room for all of its locals. Frames
+	// holding temporaries besides may overflow it before framesMax.
+	stackMax = framesMax * maxLocals
+)
+
+// callFrame is a call in progress. Its locals start at base on the stack.
+type callFrame struct {
+	closure *Closure
+	ip      int
+	base    int
+}
+
+// VM runs compiled functions. Globals persist between calls to Interpret.
+type VM struct {
+	sink    errors.Sink
+	out     io.Writer
+	globals map[string]value.Value
+
+	// frames and stack grow as deeper calls need them, up to framesMax
+	// and stackMax
+	frames     []callFrame
+	frameCount int
+
+	stack []value.Value
+	// sp is the index of the next free stack slot
+	sp int
+
+	// openUpvalues lists the upvalues still pointing into the stack
+	openUpvalues *Upvalue
+}
+
+// runtimeError unwinds the VM to Interpret when raised with panic
+type runtimeError struct {
+	code    errors.Code
+	message string
+}
+
+func New(sink errors.Sink) *VM {
+	vm := &VM{sink: sink, out: os.Stdout, globals: make(map[string]value.Value), stack: make([]value.Value, maxLocals)}
+	vm.RegisterNative("clock", 0, func(arguments []value.Value) (value.Value, error) {
+		return value.Number(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+	})
+	return vm
+}
+
+// SetOutput directs the output of print statements to w
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.out = w
+}
+
+// RegisterNative defines a global function implemented in Go. A non-nil
+// error from fn is raised as a runtime error at the call.
+func (vm *VM) RegisterNative(name string, arity int, fn func(arguments []value.Value) (value.Value, error)) {
+	vm.globals[name] = value.Obj(NewNative(name, arity, fn))
+}
+
+// Interpret runs a function compiled from the top level of a script
+func (vm *VM) Interpret(function *Function) (hadErrors bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			re, ok := err.(*runtimeError)
+			if !ok {
+				panic(err)
+			}
+			vm.report(re)
+			vm.resetStack()
+			hadErrors = true
+		}
+	}()
+
+	closure := NewClosure(function)
+	vm.push(value.Obj(closure))
+	vm.call(closure, 0)
+	vm.run()
+	return false
+}
+
+func (vm *VM) run() {
+	frame := &vm.frames[vm.frameCount-1]
+	code := frame.closure.Function.Chunk.Code
+	constants := frame.closure.Function.Chunk.Constants
+
+	readByte := func() byte {
+		frame.ip++
+		return code[frame.ip-1]
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+	}
+	readString := func() string {
+		return constants[readByte()].AsString()
+	}
+	// switchFrame reloads the cached frame after a call or return
+	switchFrame := func() {
+		frame = &vm.frames[vm.frameCount-1]
+		code = frame.closure.Function.Chunk.Code
+		constants = frame.closure.Function.Chunk.Constants
+	}
+
+	for {
+		switch OpCode(readByte()) {
+		case OP_CONSTANT:
+			vm.push(constants[readByte()])
+		case OP_NIL:
+			vm.push(value.Nil)
+		case OP_TRUE:
+			vm.push(value.True)
+		case OP_FALSE:
+			vm.push(value.False)
+		case OP_POP:
+			vm.sp--
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.base+int(readByte())])
+		case OP_SET_LOCAL:
+			vm.stack[frame.base+int(readByte())] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := readString()
+			global, ok := vm.globals[name]
+			if !ok {
+				panic(vm.error(errors.UndefinedVariable, "undefined variable '%s'.", name))
+			}
+			vm.push(global)
+		case OP_DEFINE_GLOBAL:
+			vm.globals[readString()] = vm.peek(0)
+			vm.sp--
+		case OP_SET_GLOBAL:
+			name := readString()
+			if _, ok := vm.globals[name]; !ok {
+				panic(vm.error(errors.UndefinedVariable, "undefined variable '%s'.", name))
+			}
+			vm.globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			vm.push(*frame.closure.Upvalues[readByte()].location)
+		case OP_SET_UPVALUE:
+			*frame.closure.Upvalues[readByte()].location = vm.peek(0)
+		case OP_GET_PROPERTY:
+			instance, ok := value.As[*Instance](vm.peek(0))
+			if !ok {
+				panic(vm.error(errors.PropertyOnNonInstance, "Only instances have properties."))
+			}
+			name := readString()
+			if field, ok := instance.Fields[name]; ok {
+				vm.stack[vm.sp-1] = field
+				break
+			}
+			vm.stack[vm.sp-1] = value.Obj(vm.bindMethod(instance.Class, vm.peek(0), name))
+		case OP_SET_PROPERTY:
+			instance, ok := value.As[*Instance](vm.peek(1))
+			if !ok {
+				panic(vm.error(errors.FieldOnNonInstance, "Only instances have fields."))
+			}
+			field := vm.pop()
+			instance.Fields[readString()] = field
+			vm.stack[vm.sp-1] = field
+		case OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().AsObject().(*Class)
+			vm.stack[vm.sp-1] = value.Obj(vm.bindMethod(superclass, vm.peek(0), name))
+		case OP_EQUAL:
+			b := vm.pop()
+			vm.stack[vm.sp-1] = value.Bool(value.Equal(vm.stack[vm.sp-1], b))
+		case OP_GREATER:
+			a, b := vm.numberOperands()
+			vm.push(value.Bool(a > b))
+		case OP_LESS:
+			a, b := vm.numberOperands()
+			vm.push(value.Bool(a < b))
+		case OP_ADD:
+			if a, b := vm.peek(1), vm.peek(0); a.IsString() && b.IsString() {
+				vm.sp--
+				vm.stack[vm.sp-1] = value.String(a.AsString() + b.AsString())
+				break
+			}
+			a, b := vm.numberOperands()
+			vm.push(value.Number(a + b))
+		case OP_SUBTRACT:
+			a, b := vm.numberOperands()
+			vm.push(value.Number(a - b))
+		case OP_MULTIPLY:
+			a, b := vm.numberOperands()
+			vm.push(value.Number(a * b))
+		case OP_DIVIDE:
+			a, b := vm.numberOperands()
+			vm.push(value.Number(a / b))
+		case OP_NOT:
+			vm.stack[vm.sp-1] = value.Bool(!vm.peek(0).Truthy())
+		case OP_NEGATE:
+			if !vm.peek(0).IsNumber() {
+				panic(vm.error(errors.OperandType, "Operand must be a number."))
+			}
+			vm.stack[vm.sp-1] = value.Number(-vm.peek(0).AsNumber())
+		case OP_PRINT:
+			fmt.Fprintln(vm.out, vm.pop())
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !vm.peek(0).Truthy() {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argCount := int(readByte())
+			vm.callValue(vm.peek(argCount), argCount)
+			switchFrame()
+		case OP_INVOKE:
+			name := readString()
+			argCount := int(readByte())
+			vm.invoke(name, argCount)
+			switchFrame()
+		case OP_SUPER_INVOKE:
+			name := readString()
+			argCount := int(readByte())
+			superclass := vm.pop().AsObject().(*Class)
+			vm.invokeFromClass(superclass, name, argCount)
+			switchFrame()
+		case OP_CLOSURE:
+			function := constants[readByte()].AsObject().(*Function)
+			closure := NewClosure(function)
+			vm.push(value.Obj(closure))
+			for i := range closure.Upvalues {
+				isLocal := readByte()
+				index := int(readByte())
+				if isLocal == 1 {
+					closure.Upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.Upvalues[i] = frame.closure.Upvalues[index]
+				}
+			}
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.frameCount--
+			if vm.frameCount == 0 {
+				vm.sp--
+				return
+			}
+			vm.sp = frame.base
+			vm.push(result)
+			switchFrame()
+		case OP_CLASS:
+			vm.push(value.Obj(NewClass(readString())))
+		case OP_INHERIT:
+			superclass, ok := value.As[*Class](vm.peek(1))
+			if !ok {
+				panic(vm.error(errors.SuperclassNotClass, "Superclass must be a class."))
+			}
+			// methods are copied down so lookups never walk the chain
+			subclass := vm.peek(0).AsObject().(*Class)
+			for name, method := range superclass.Methods {
+				subclass.Methods[name] = method
+			}
+			vm.sp--
+		case OP_METHOD:
+			name := readString()
+			class := vm.peek(1).AsObject().(*Class)
+			class.Methods[name] = vm.pop().AsObject().(*Closure)
+		}
+	}
+}
+
+func (vm *VM) callValue(callee value.Value, argCount int) {
+	if !callee.IsObject() {
+		panic(vm.error(errors.NotCallable, "Can only call functions and classes."))
+	}
+
+	switch c := callee.AsObject().(type) {
+	case *Closure:
+		vm.call(c, argCount)
+		return
+	case *BoundMethod:
+		vm.stack[vm.sp-argCount-1] = c.Receiver
+		vm.call(c.Method, argCount)
+		return
+	case *Class:
+		vm.stack[vm.sp-argCount-1] = value.Obj(NewInstance(c))
+		if initializer, ok := c.Methods["init"]; ok {
+			vm.call(initializer, argCount)
+		} else if argCount != 0 {
+			panic(vm.error(errors.ArityMismatch, "Expected 0 arguments but got %d.", argCount))
+		}
+		return
+	case *Native:
+		if argCount != c.Arity {
+			panic(vm.error(errors.ArityMismatch, "Expected %d arguments but got %d.", c.Arity, argCount))
+		}
+		arguments := make([]value.Value, argCount)
+		copy(arguments, vm.stack[vm.sp-argCount:vm.sp])
+		result, err := c.Fn(arguments)
+		if err != nil {
+			panic(vm.error(errors.NativeError, "%s: %s", c.Name, err))
+		}
+		vm.sp -= argCount + 1
+		vm.push(result)
+		return
+	}
+	panic(vm.error(errors.NotCallable, "Can only call functions and classes."))
+}
+
+func (vm *VM) call(closure *Closure, argCount int) {
+	if argCount != closure.Function.Arity {
+		panic(vm.error(errors.ArityMismatch, "Expected %d arguments but got %d.", closure.Function.Arity, argCount))
+	}
+	if vm.frameCount == framesMax {
+		panic(vm.error(errors.StackOverflow, "Stack overflow: more than %d nested calls.", framesMax-1))
+	}
+
+	// the frame run is executing may move, so run reloads it after calls
+	if vm.frameCount == len(vm.frames) {
+		vm.frames = append(vm.frames, callFrame{})
+	}
+	vm.frames[vm.frameCount] = callFrame{closure: closure, base: vm.sp - argCount - 1}
+	vm.frameCount++
+}
+
+// invoke calls a method on the receiver below the arguments without
+// creating a bound method
+func (vm *VM) invoke(name string, argCount int) {
+	instance, ok := value.As[*Instance](vm.peek(argCount))
+	if !ok {
+		panic(vm.error(errors.PropertyOnNonInstance, "Only instances have properties."))
+	}
+
+	// a field holding a function shadows a method of the same name
+	if field, ok := instance.Fields[name]; ok {
+		vm.stack[vm.sp-argCount-1] = field
+		vm.callValue(field, argCount)
+		return
+	}
+
+	vm.invokeFromClass(instance.Class, name, argCount)
+}
+
+func (vm *VM) invokeFromClass(class *Class, name string, argCount int) {
+	method, ok := class.Methods[name]
+	if !ok {
+		panic(vm.error(errors.UndefinedProperty, "Undefined property '%s'.", name))
+	}
+	vm.call(method, argCount)
+}
+
+func (vm *VM) bindMethod(class *Class, receiver value.Value, name string) *BoundMethod {
+	method, ok := class.Methods[name]
+	if !ok {
+		panic(vm.error(errors.UndefinedProperty, "Undefined property '%s'.", name))
+	}
+	return NewBoundMethod(receiver, method)
+}
+
+// captureUpvalue reuses the open upvalue for slot if a closure already
+// captured it, so closures share the variable
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var previous *Upvalue
+	current := vm.openUpvalues
+	for current != nil && current.slot > slot {
+		previous = current
+		current = current.next
+	}
+	if current != nil && current.slot == slot {
+		return current
+	}
+
+	created := &Upvalue{location: &vm.stack[slot], slot: slot, next: current}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves the variables at or above slot off the stack
+func (vm *VM) closeUpvalues(slot int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= slot {
+		upvalue := vm.openUpvalues
+		upvalue.closed = *upvalue.location
+		upvalue.location = &upvalue.closed
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+// numberOperands pops the two operands of a binary operator on numbers
+func (vm *VM) numberOperands() (float64, float64) {
+	a, b := vm.peek(1), vm.peek(0)
+	if !a.IsNumber() || !b.IsNumber() {
+		panic(vm.error(errors.OperandType, "operands must be numbers."))
+	}
+	vm.sp -= 2
+	return a.AsNumber(), b.AsNumber()
+}
+
+func (vm *VM) push(val value.Value) {
+	if vm.sp == len(vm.stack) {
+		vm.growStack()
+	}
+	vm.stack[vm.sp] = val
+	vm.sp++
+}
+
+// growStack doubles the stack and moves the open upvalues to point into
+// the new one
+func (vm *VM) growStack() {
+	if len(vm.stack) == stackMax {
+		panic(vm.error(errors.StackOverflow, "Stack overflow: more than %d values on the stack.", stackMax))
+	}
+	stack := make([]value.Value, min(2*len(vm.stack), stackMax))
+	copy(stack, vm.stack)
+	vm.stack = stack
+
+	for upvalue := vm.openUpvalues; upvalue != nil; upvalue = upvalue.next {
+		upvalue.location = &vm.stack[upvalue.slot]
+	}
+}
+
+func (vm *VM) pop() value.Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) peek(distance int) value.Value {
+	return vm.stack[vm.sp-1-distance]
+}
+
+func (vm *VM) resetStack() {
+	clear(vm.stack[:vm.sp])
+	vm.sp = 0
+	vm.frameCount = 0
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) error(code errors.Code, format string, args ...any) *runtimeError {
+	return &runtimeError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// report sends a runtime error to the sink with the stack trace of the
+// frames still active, innermost first
+func (vm *VM) report(err *runtimeError) {
+	stack := []errors.Frame{}
+	for i := vm.frameCount - 1; i >= 0; i-- {
+		frame := &vm.frames[i]
+		function := frame.closure.Function
+		name := function.Name
+		if name == "" {
+			name = "<script>"
+		}
+		stack = append(stack, errors.Frame{Function: name, Span: function.Chunk.Spans[frame.ip-1]})
+	}
+
+	d := errors.Diagnostic{Code: err.code, Message: err.message}
+	if len(stack) > 0 {
+		d.Span = stack[0].Span
+	}
+
+	stack, omitted := errors.TrimStack(stack)
+	if omitted > 0 {
+		d.Notes = append(d.Notes, fmt.Sprintf("%d frames omitted from the stack trace", omitted))
+	}
+	d.Stack = stack
+	vm.sink.Report(d)
+}
@@ -0,0 +1,387 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/maffkipp/golox"
+	"github.com/maffkipp/golox/errors"
+	"github.com/maffkipp/golox/lexer"
+	"github.com/maffkipp/golox/parser"
+)
+
+// Each snippet runs on the tree-walker and on the VM, which must print
+// the same output and fail with the same error code
+var programs = []struct {
+	name   string
+	source string
+	// want is the expected output, checked as well as the agreement
+	want string
+	// code is the error code both backends must stop with, if any
+	code errors.Code
+}{
+	{
+		name:   "arithmetic",
+		source: `print 1 + 2 * 3; print (1 + 2) * 3; print 10 / 4; print -(3 - 5);`,
+		want:   "7\n9\n2.5\n2\n",
+	},
+	{
+		name:   "strings",
+		source: `var a = "lo"; print "hel" + a; print "a" == "a"; print "a" != "b";`,
+		want:   "hello\ntrue\ntrue\n",
+	},
+	{
+		name:   "truthiness",
+		source: `print !nil; print !0; print !""; print nil == false; print 1 == 1;`,
+		want:   "true\nfalse\nfalse\nfalse\ntrue\n",
+	},
+	{
+		name:   "logical operators",
+		source: `print nil or "default"; print 1 and 2; print false and undefined; print "x" or undefined;`,
+		want:   "default\n2\nfalse\nx\n",
+	},
+	{
+		name: "if and else",
+		source: `
+			for (var i = 0; i < 3; i = i + 1) {
+				if (i == 0) print "zero"; else if (i == 1) print "one"; else print "many";
+			}`,
+		want: "zero\none\nmany\n",
+	},
+	{
+		name: "nested loops",
+		source: `
+			var total = 0;
+			var i = 0;
+			while (i < 10) {
+				for (var j = 0; j < i; j = j + 1) {
+					if (j > 5) total = total + 100; else total = total + 1;
+				}
+				i = i + 1;
+			}
+			print total;`,
+		want: "639\n",
+	},
+	{
+		// the patched jumps span a body of several hundred bytes
+		name: "long jump",
+		source: `
+			var n = 0;
+			if (n == 0) {
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+				n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1; n = n + 1;
+			} else {
+				n = -1;
+			}
+			print n;`,
+		want: "48\n",
+	},
+	{
+		name: "block scope",
+		source: `
+			var a = "global";
+			{
+				var a = "outer";
+				{ var a = "inner"; print a; }
+				print a;
+			}
+			print a;`,
+		want: "inner\nouter\nglobal\n",
+	},
+	{
+		name: "recursion",
+		source: `
+			fun fib(n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+			print fib(15);`,
+		want: "610\n",
+	},
+	{
+		name: "closure counter",
+		source: `
+			fun makeCounter() {
+				var count = 0;
+				fun increment() { count = count + 1; return count; }
+				return increment;
+			}
+			var a = makeCounter();
+			var b = makeCounter();
+			print a(); print a(); print b();`,
+		want: "1\n2\n1\n",
+	},
+	{
+		// the upvalue is closed when the block ends, after the closure
+		// has been created but before it is called
+		name: "upvalue closed at block end",
+		source: `
+			var f;
+			{
+				var local = "before";
+				fun show() { print local; }
+				local = "after";
+				f = show;
+			}
+			f();`,
+		want: "after\n",
+	},
+	{
+		name: "closures share an upvalue",
+		source: `
+			var get; var set;
+			fun pair() {
+				var shared = 1;
+				fun g() { return shared; }
+				fun s(v) { shared = v; }
+				get = g; set = s;
+			}
+			pair();
+			set(42);
+			print get();`,
+		want: "42\n",
+	},
+	{
+		// each iteration's body block closes its own variable
+		name: "upvalues closed per iteration",
+		source: `
+			var fs = nil; var gs = nil; var hs = nil;
+			for (var i = 0; i < 3; i = i + 1) {
+				var j = i;
+				fun f() { return j; }
+				if (fs == nil) fs = f; else if (gs == nil) gs = f; else hs = f;
+			}
+			print fs(); print gs(); print hs();`,
+		want: "0\n1\n2\n",
+	},
+	{
+		name: "nested upvalues",
+		source: `
+			fun outer() {
+				var x = "x";
+				fun middle() {
+					fun inner() { return x; }
+					return inner;
+				}
+				return middle;
+			}
+			print outer()()();`,
+		want: "x\n",
+	},
+	{
+		name: "classes and fields",
+		source: `
+			class Point {
+				init(x, y) { this.x = x; this.y = y; }
+				sum() { return this.x + this.y; }
+			}
+			var p = Point(1, 2);
+			p.x = 10;
+			print p.sum();
+			print p;
+			print Point;`,
+		want: "12\nPoint instance\nPoint\n",
+	},
+	{
+		name: "bound method",
+		source: `
+			class Greeter {
+				init(name) { this.name = name; }
+				greet() { print "hi " + this.name; }
+			}
+			var m = Greeter("lox").greet;
+			m();`,
+		want: "hi lox\n",
+	},
+	{
+		name: "field shadows method",
+		source: `
+			class A { f() { return "method"; } }
+			fun g() { return "field"; }
+			var a = A();
+			a.f = g;
+			print a.f();`,
+		want: "field\n",
+	},
+	{
+		name: "super invoke",
+		source: `
+			class A {
+				method() { return "A method"; }
+				describe() { return "A"; }
+			}
+			class B < A {
+				method() { return "B " + super.method(); }
+				describe() { return "B<" + super.describe() + ">"; }
+			}
+			class C < B {
+				method() { return "C " + super.method(); }
+			}
+			print C().method();
+			print C().describe();`,
+		want: "C B A method\nB<A>\n",
+	},
+	{
+		name: "super bound method",
+		source: `
+			class A { name() { return "A"; } }
+			class B < A {
+				get() { var m = super.name; return m; }
+			}
+			print B().get()();`,
+		want: "A\n",
+	},
+	{
+		name: "inherited initializer",
+		source: `
+			class A { init(v) { this.v = v; } }
+			class B < A {}
+			print B(7).v;`,
+		want: "7\n",
+	},
+	{
+		name:   "undefined variable",
+		source: `print "before"; print missing;`,
+		want:   "before\n",
+		code:   errors.UndefinedVariable,
+	},
+	{
+		name:   "operand type",
+		source: `print 1; print 1 + "a";`,
+		want:   "1\n",
+		code:   errors.OperandType,
+	},
+	{
+		name:   "wrong arity",
+		source: `fun f(a, b) {} f(1);`,
+		code:   errors.ArityMismatch,
+	},
+	{
+		name:   "call non-callable",
+		source: `var x = "text"; x();`,
+		code:   errors.NotCallable,
+	},
+	{
+		name:   "undefined property",
+		source: `class A {} print A().missing;`,
+		code:   errors.UndefinedProperty,
+	},
+	{
+		name:   "deep recursion",
+		source: `fun f(n) { return f(n + 1); } f(0);`,
+		code:   errors.StackOverflow,
+	},
+	{
+		// both backends allow parser.DefaultMaxCallDepth nested calls
+		name: "recursion at the call depth limit",
+		source: `
+			fun depth(n) { if (n == 0) return 0; return depth(n - 1) + 1; }
+			print depth(9999);`,
+		want: "9999\n",
+	},
+	{
+		name: "recursion past the call depth limit",
+		source: `
+			fun depth(n) { if (n == 0) return 0; return depth(n - 1) + 1; }
+			print depth(10000);`,
+		code: errors.StackOverflow,
+	},
+	{
+		// the stack grows while x is captured but still on it
+		name: "upvalue open while the stack grows",
+		source: `
+			fun outer() {
+				var x = "before";
+				fun get() { return x; }
+				fun deep(n) {
+					if (n == 0) { x = "after"; return get(); }
+					return deep(n - 1);
+				}
+				return deep(2000) + " " + x;
+			}
+			print outer();`,
+		want: "after after\n",
+	},
+	{
+		// each frame holds many temporaries, so the values on the stack
+		// run out before the frames do
+		name: "deep recursion with many temporaries",
+		source: `
+			fun f(n) {
+				return f(n + 1) + ` + strings.Repeat("(1 + ", 250) + "1" + strings.Repeat(")", 250) + `;
+			}
+			f(0);`,
+		code: errors.StackOverflow,
+	},
+}
+
+func TestBackendsAgree(t *testing.T) {
+	for _, p := range programs {
+		t.Run(p.name, func(t *testing.T) {
+			treeOut, treeCode := runTree(t, p.source)
+			vmOut, vmCode := runVM(t, p.source)
+
+			if treeOut != vmOut {
+				t.Errorf("tree-walker printed %q but VM printed %q", treeOut, vmOut)
+			}
+			if vmOut != p.want {
+				t.Errorf("printed %q, want %q", vmOut, p.want)
+			}
+			if treeCode != p.code || vmCode != p.code {
+				t.Errorf("tree-walker failed with %q and VM with %q, want %q", treeCode, vmCode, p.code)
+			}
+		})
+	}
+}
+
+// runTree returns what source prints on the tree-walker and the code of
+// the runtime error it stops with, if any
+func runTree(t *testing.T, source string) (string, errors.Code) {
+	t.Helper()
+	var out bytes.Buffer
+	rt := golox.New(golox.Options{Stdout: &out, Stderr: io.Discard})
+	_, err := rt.Eval(context.Background(), source)
+	if err == nil {
+		return out.String(), ""
+	}
+	e, ok := err.(*golox.Error)
+	if !ok || !e.Runtime {
+		t.Fatalf("tree-walker: %v", err)
+	}
+	return out.String(), e.Diagnostics[0].Code
+}
+
+// runVM returns what source prints on the VM and the code of the runtime
+// error it stops with, if any
+func runVM(t *testing.T, source string) (string, errors.Code) {
+	t.Helper()
+	diagnostics := &errors.Collector{}
+
+	tokens, hadErrors := lexer.NewScanner(source, diagnostics).ScanTokens()
+	if hadErrors {
+		t.Fatalf("VM: scanning: %v", diagnostics.Diagnostics)
+	}
+	statements, hadErrors := parser.NewParser(tokens, diagnostics).Parse()
+	if hadErrors {
+		t.Fatalf("VM: parsing: %v", diagnostics.Diagnostics)
+	}
+	if hadErrors := parser.NewResolver(nil, diagnostics).Resolve(statements); hadErrors {
+		t.Fatalf("VM: resolving: %v", diagnostics.Diagnostics)
+	}
+	function, hadErrors := NewCompiler(diagnostics).Compile(statements)
+	if hadErrors {
+		t.Fatalf("VM: compiling: %v", diagnostics.Diagnostics)
+	}
+
+	var out bytes.Buffer
+	machine := New(diagnostics)
+	machine.SetOutput(&out)
+	if hadErrors := machine.Interpret(function); hadErrors {
+		return out.String(), diagnostics.Diagnostics[0].Code
+	}
+	return out.String(), ""
+}